@@ -0,0 +1,107 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/gorilla/mux"
+)
+
+type APIKeyHandler struct {
+	store store.APIKeyStore
+}
+
+func NewAPIKeyHandler(store store.APIKeyStore) *APIKeyHandler {
+	return &APIKeyHandler{store: store}
+}
+
+func (h *APIKeyHandler) HandleCreate(w http.ResponseWriter, r *http.Request) error {
+	tokenPayload, err := helpers.GetTokenPayloadFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	var request types.CreateAPIKeyRequest
+	if err := helpers.DecodeRequest(r, &request); err != nil {
+		return err
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	prefix, key, err := helpers.GenerateAPIKey()
+	if err != nil {
+		return err
+	}
+
+	apiKey, err := h.store.Insert(r.Context(), request.Name, prefix, helpers.HashAPIKey(key), request.Scopes, tokenPayload.Id, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteJSON(w, http.StatusCreated, types.APIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+func (h *APIKeyHandler) HandleGetAll(w http.ResponseWriter, r *http.Request) error {
+	keys, err := h.store.GetAll(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteJSON(w, http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) HandleRotate(w http.ResponseWriter, r *http.Request) error {
+	id := mux.Vars(r)["id"]
+
+	apiKey, err := h.store.GetById(r.Context(), id)
+	if err == sql.ErrNoRows {
+		return helpers.APIKeyNotFound()
+	}
+	if err != nil {
+		return err
+	}
+
+	if apiKey.RevokedAt != nil {
+		return helpers.APIKeyNotFound()
+	}
+
+	prefix, key, err := helpers.GenerateAPIKey()
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.Rotate(r.Context(), id, prefix, helpers.HashAPIKey(key)); err != nil {
+		return err
+	}
+
+	apiKey, err = h.store.GetById(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteJSON(w, http.StatusOK, types.APIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+func (h *APIKeyHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) error {
+	id := mux.Vars(r)["id"]
+
+	if _, err := h.store.GetById(r.Context(), id); err == sql.ErrNoRows {
+		return helpers.APIKeyNotFound()
+	} else if err != nil {
+		return err
+	}
+
+	if err := h.store.Revoke(r.Context(), id); err != nil {
+		return err
+	}
+
+	return helpers.WriteOK(w)
+}
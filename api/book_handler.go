@@ -1,7 +1,7 @@
 package api
 
 import (
-	"encoding/json"
+	"database/sql"
 
 	"net/http"
 	"strconv"
@@ -21,7 +21,7 @@ func NewBookHandler(store store.BookStore) *BookHandler {
 }
 
 func (h *BookHandler) HandleGetAll(w http.ResponseWriter, r *http.Request) error {
-	books, err := h.store.GetAll()
+	books, err := h.store.GetAll(r.Context())
 	if err != nil {
 		return err
 	}
@@ -36,9 +36,12 @@ func (h *BookHandler) HandleGetById(w http.ResponseWriter, r *http.Request) erro
 		return helpers.InvalidRouteVariables()
 	}
 
-	book, err := h.store.GetById(id)
+	book, err := h.store.GetById(r.Context(), id)
+	if err == sql.ErrNoRows {
+		return helpers.BookNotFound()
+	}
 	if err != nil {
-		return helpers.NotFoundData()
+		return err
 	}
 
 	return helpers.WriteJSON(w, http.StatusOK, book)
@@ -46,15 +49,11 @@ func (h *BookHandler) HandleGetById(w http.ResponseWriter, r *http.Request) erro
 
 func (h *BookHandler) HandleInsert(w http.ResponseWriter, r *http.Request) error {
 	var book types.AddBookRequest
-	if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
-		return helpers.InvalidJSON()
-	}
-
-	if book.Name == "" {
-		return helpers.InvalidRequestData()
+	if err := helpers.DecodeRequest(r, &book); err != nil {
+		return err
 	}
 
-	if err := h.store.Insert(book.Name); err != nil {
+	if err := h.store.Insert(r.Context(), book.Name, book.Quantity); err != nil {
 		return err
 	}
 
@@ -69,15 +68,15 @@ func (h *BookHandler) HandleUpdate(w http.ResponseWriter, r *http.Request) error
 	}
 
 	var book types.UpdateBookRequest
-	if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
-		return helpers.InvalidJSON()
+	if err := helpers.DecodeRequest(r, &book); err != nil {
+		return err
 	}
 
-	if book.Name == "" {
-		return helpers.InvalidRequestData()
+	err = h.store.Update(r.Context(), id, book.Name)
+	if err == sql.ErrNoRows {
+		return helpers.BookNotFound()
 	}
-
-	if err := h.store.Update(id, book.Name); err != nil {
+	if err != nil {
 		return err
 	}
 
@@ -91,7 +90,35 @@ func (h *BookHandler) HandleDelete(w http.ResponseWriter, r *http.Request) error
 		return helpers.InvalidRouteVariables()
 	}
 
-	if err := h.store.Delete(id); err != nil {
+	err = h.store.Delete(r.Context(), id)
+	if err == sql.ErrNoRows {
+		return helpers.BookNotFound()
+	}
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteOK(w)
+}
+
+// HandleAddStock adds copies of a book
+func (h *BookHandler) HandleAddStock(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return helpers.InvalidRouteVariables()
+	}
+
+	var request types.AddStockRequest
+	if err := helpers.DecodeRequest(r, &request); err != nil {
+		return err
+	}
+
+	err = h.store.AddStock(r.Context(), id, request.Quantity)
+	if err == sql.ErrNoRows {
+		return helpers.BookNotFound()
+	}
+	if err != nil {
 		return err
 	}
 
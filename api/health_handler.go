@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+)
+
+// HealthCheck reports the state of one dependency or background worker.
+// A failing critical check makes the server not ready, others are only reported.
+type HealthCheck struct {
+	Name     string
+	Critical bool
+	Check    func(ctx context.Context) error
+}
+
+type HealthCheckResult struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type HealthResponse struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+const (
+	healthOK          = "ok"
+	healthFailing     = "failing"
+	healthUnavailable = "unavailable"
+	healthDraining    = "draining"
+)
+
+// HealthHandler serves liveness and readiness probes
+type HealthHandler struct {
+	timeout  time.Duration
+	checks   []HealthCheck
+	draining atomic.Bool
+}
+
+func NewHealthHandler(timeout time.Duration) *HealthHandler {
+	return &HealthHandler{timeout: timeout}
+}
+
+// AddCheck must be called before the server starts
+func (h *HealthHandler) AddCheck(name string, critical bool, check func(ctx context.Context) error) {
+	h.checks = append(h.checks, HealthCheck{Name: name, Critical: critical, Check: check})
+}
+
+// SetDraining makes readiness fail, so no new traffic is sent during a shutdown
+func (h *HealthHandler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// HandleLiveness only tells the process is serving, it never checks dependencies
+// so a database outage doesn't get every replica restarted
+func (h *HealthHandler) HandleLiveness(w http.ResponseWriter, r *http.Request) error {
+	return helpers.WriteJSON(w, http.StatusOK, HealthResponse{Status: healthOK})
+}
+
+// HandleReadiness runs every check in parallel, each bounded by the timeout
+func (h *HealthHandler) HandleReadiness(w http.ResponseWriter, r *http.Request) error {
+	response := HealthResponse{Status: healthOK, Checks: make(map[string]HealthCheckResult, len(h.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Check(ctx)
+			result := HealthCheckResult{Status: healthOK, Critical: check.Critical, Duration: time.Since(start).String()}
+			if err != nil {
+				result.Status = healthFailing
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[check.Name] = result
+			if err != nil && check.Critical {
+				response.Status = healthUnavailable
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	if h.draining.Load() {
+		response.Status = healthDraining
+	}
+
+	status := http.StatusOK
+	if response.Status != healthOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	return helpers.WriteJSON(w, status, response)
+}
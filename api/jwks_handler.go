@@ -0,0 +1,13 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+)
+
+// HandleJWKS publishes the public keys used to sign tokens
+func HandleJWKS(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	return helpers.WriteJSON(w, http.StatusOK, helpers.Keys().JWKS())
+}
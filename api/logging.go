@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/metrics"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RequestIdHeader = "X-Request-ID"
+	// Longer or unusual incoming ids are replaced, they end up in every log line
+	maxRequestIdLength = 128
+)
+
+// Probes are polled every few seconds, their access logs are only written at debug level
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true}
+
+// RequestLogger assigns every request an X-Request-ID, or keeps the one sent by a proxy,
+// puts a logger carrying it into the request context and writes one access log line per request.
+// It also records the HTTP metrics, it is the one place that knows the route and status.
+func RequestLogger(logger *slog.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestId := r.Header.Get(RequestIdHeader)
+			if !validRequestId(requestId) {
+				requestId = newRequestId()
+			}
+			w.Header().Set(RequestIdHeader, requestId)
+
+			requestLogger := logger.With("request_id", requestId)
+			if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+				requestLogger = requestLogger.With("trace_id", span.TraceID().String())
+			}
+
+			entry := &helpers.AccessLog{}
+			ctx := context.WithValue(r.Context(), types.KeyRequestId, requestId)
+			ctx = helpers.WithLogger(ctx, requestLogger)
+			ctx = helpers.WithAccessLog(ctx, entry)
+			r = r.WithContext(ctx)
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			route := routeTemplate(r)
+			latency := time.Since(start)
+			metrics.ObserveRequest(r.Method, route, recorder.status, latency)
+
+			level := slog.LevelInfo
+			if recorder.status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			} else if quietPaths[r.URL.Path] {
+				level = slog.LevelDebug
+			}
+
+			requestLogger.LogAttrs(ctx, level, "request",
+				slog.String("method", r.Method),
+				slog.String("route", route),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", recorder.status),
+				slog.Duration("latency", latency),
+				slog.Int64("bytes", recorder.bytes),
+				slog.String("user_id", entry.UserId),
+				slog.String("ip", helpers.ClientIP(r)),
+			)
+		})
+	}
+}
+
+// routeTemplate returns the template of the matched route, empty for unmatched requests (404, 405)
+func routeTemplate(r *http.Request) string {
+	current := mux.CurrentRoute(r)
+	if current == nil {
+		return ""
+	}
+
+	route, _ := current.GetPathTemplate()
+	return route
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+	for _, c := range id {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '-' && c != '_' && c != '.' && c != ':' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+)
+
+// Attempts outside the window are deleted at most this often, on the next attempt
+const loginPruneInterval = time.Minute
+
+// LoginThrottler slows down password guessing per username and per client IP.
+// Every failure after BackoffAfter doubles the wait before the next attempt.
+// The next attempt after LockoutAfter failures locks the username for LockoutDuration.
+type LoginThrottler struct {
+	store           store.LoginAttemptStore
+	pruneMu         sync.Mutex
+	lastPrune       time.Time
+	Window          time.Duration
+	BackoffAfter    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+}
+
+func NewLoginThrottler(store store.LoginAttemptStore) *LoginThrottler {
+	return &LoginThrottler{
+		store:           store,
+		Window:          time.Minute * 15,
+		BackoffAfter:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute * 5,
+		LockoutAfter:    10,
+		LockoutDuration: time.Minute * 15,
+	}
+}
+
+// Usernames are case-insensitive in the users table, so "alice" and "ALICE" share a budget
+func normalizeUsername(username string) string {
+	return strings.ToLower(username)
+}
+
+func userKey(username string) string {
+	return "user:" + normalizeUsername(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Attempt counts a login attempt before the password or code is checked, so parallel guesses
+// can't all pass. It returns how long the caller has to wait, zero if it may try now.
+// The attempt stays counted as a failure unless Success is called with the same time.
+func (t *LoginThrottler) Attempt(ctx context.Context, username, ip string, now time.Time) (time.Duration, error) {
+	if err := t.prune(ctx, now); err != nil {
+		return 0, err
+	}
+
+	username = normalizeUsername(username)
+	lockedUntil, err := t.store.GetLockedUntil(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+
+	if now.Before(lockedUntil) {
+		return lockedUntil.Sub(now), nil
+	}
+
+	since := now.Add(-t.Window)
+	_, wait, err := t.store.Attempt(ctx, ipKey(ip), now, since, t.delay)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+
+	attempts, wait, err := t.store.Attempt(ctx, userKey(username), now, since, t.delay)
+	if err == nil && wait == 0 && attempts > t.LockoutAfter {
+		wait, err = t.lock(ctx, username, ip, now, attempts-1)
+	}
+	if err != nil || wait == 0 {
+		return wait, err
+	}
+
+	// A rejected attempt doesn't use the budget of the IP
+	return wait, t.store.RemoveAttempt(ctx, ipKey(ip), now)
+}
+
+// lock is called on the first attempt after LockoutAfter failures
+func (t *LoginThrottler) lock(ctx context.Context, username, ip string, now time.Time, failures int) (time.Duration, error) {
+	if err := t.store.Lock(ctx, username, now.Add(t.LockoutDuration)); err != nil {
+		return 0, err
+	}
+
+	helpers.SecurityEvent(ctx, "account_lockout", "username", username, "ip", ip, "failures", failures)
+
+	if err := t.store.ClearAttempts(ctx, userKey(username)); err != nil {
+		return 0, err
+	}
+
+	return t.LockoutDuration, nil
+}
+
+// Success resets the username and takes back the attempt made at the given time from the IP.
+// The earlier failures of the IP stay, so one valid account can't be used to reset the
+// guessing budget of an attacker.
+func (t *LoginThrottler) Success(ctx context.Context, username, ip string, at time.Time) error {
+	if err := t.store.ClearAttempts(ctx, userKey(username)); err != nil {
+		return err
+	}
+
+	return t.store.RemoveAttempt(ctx, ipKey(ip), at)
+}
+
+func (t *LoginThrottler) Unlock(ctx context.Context, username string) error {
+	if err := t.store.Unlock(ctx, normalizeUsername(username)); err != nil {
+		return err
+	}
+
+	return t.store.ClearAttempts(ctx, userKey(username))
+}
+
+// prune drops failures that left the window, otherwise keys that are never read again,
+// like random usernames, would stay forever
+func (t *LoginThrottler) prune(ctx context.Context, now time.Time) error {
+	t.pruneMu.Lock()
+	if now.Sub(t.lastPrune) < loginPruneInterval {
+		t.pruneMu.Unlock()
+		return nil
+	}
+	t.lastPrune = now
+	t.pruneMu.Unlock()
+
+	return t.store.Prune(ctx, now.Add(-t.Window))
+}
+
+func (t *LoginThrottler) delay(failures int) time.Duration {
+	if failures < t.BackoffAfter {
+		return 0
+	}
+
+	delay := t.BaseDelay
+	for i := t.BackoffAfter; i < failures && delay < t.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, t.MaxDelay)
+}
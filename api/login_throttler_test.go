@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+)
+
+func TestLoginThrottlesParallelAttempts(t *testing.T) {
+	stores := store.NewMemoryStores()
+	router := NewRouter(stores, RouterConfig{Logger: testLogger()})
+
+	hashed, err := helpers.HashPassword("Correct-Horse-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Users.Insert(context.Background(), "alice", hashed, "Alice", "A", "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every guess is in flight before any of them is checked
+	const attempts = 60
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := strings.NewReader(`{"username": "alice", "password": "wrong password"}`)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/user/login", body))
+			codes <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+
+	backoffAfter := NewLoginThrottler(nil).BackoffAfter
+	if counts[http.StatusUnauthorized] != backoffAfter || counts[http.StatusTooManyRequests] != attempts-backoffAfter {
+		t.Fatalf("got %v, expected %d checked passwords and the rest throttled", counts, backoffAfter)
+	}
+}
+
+func TestLoginThrottlerIgnoresUsernameCase(t *testing.T) {
+	throttler := NewLoginThrottler(store.NewMemoryLoginAttemptStore())
+	throttler.BackoffAfter = 100
+	throttler.LockoutAfter = 2
+
+	ctx := context.Background()
+	now := time.Now()
+	attempt := func(username string) time.Duration {
+		t.Helper()
+		// A new IP every time, only the username budget is tested
+		wait, err := throttler.Attempt(ctx, username, "192.0.2."+username, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wait
+	}
+
+	for _, username := range []string{"alice", "Alice"} {
+		if wait := attempt(username); wait != 0 {
+			t.Fatalf("attempt as %s waits %s", username, wait)
+		}
+	}
+
+	// The next attempt locks the account, whatever the case
+	if wait := attempt("ALICE"); wait != throttler.LockoutDuration {
+		t.Fatalf("got wait %s, expected the lockout", wait)
+	}
+	if wait := attempt("alice"); wait == 0 {
+		t.Fatal("locked account accepted an attempt")
+	}
+
+	if err := throttler.Unlock(ctx, "aLiCe"); err != nil {
+		t.Fatal(err)
+	}
+	if wait := attempt("alice"); wait != 0 {
+		t.Fatalf("unlocked account waits %s", wait)
+	}
+}
+
+func TestLoginThrottlerSuccessKeepsIPFailures(t *testing.T) {
+	throttler := NewLoginThrottler(store.NewMemoryLoginAttemptStore())
+	throttler.BackoffAfter = 2
+
+	ctx := context.Background()
+	now := time.Now()
+	const ip = "192.0.2.1"
+
+	// One failure from the IP, then a successful login of another account
+	if wait, err := throttler.Attempt(ctx, "mallory", ip, now); err != nil || wait != 0 {
+		t.Fatalf("first attempt waits %s: %v", wait, err)
+	}
+	if wait, err := throttler.Attempt(ctx, "bob", ip, now); err != nil || wait != 0 {
+		t.Fatalf("second attempt waits %s: %v", wait, err)
+	}
+	if err := throttler.Success(ctx, "bob", ip, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The success doesn't count, the failure does
+	if wait, err := throttler.Attempt(ctx, "carol", ip, now); err != nil || wait != 0 {
+		t.Fatalf("attempt after the success waits %s: %v", wait, err)
+	}
+	if wait, err := throttler.Attempt(ctx, "dave", ip, now); err != nil || wait == 0 {
+		t.Fatalf("third attempt of the IP wasn't throttled: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestMain(m *testing.M) {
+	keys, err := helpers.LoadKeyManager(testSecret, "", "")
+	if err != nil {
+		panic(err)
+	}
+	helpers.SetKeyManager(keys)
+
+	// Handlers log through the request logger or the default one, both are noise in tests
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	os.Exit(m.Run())
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
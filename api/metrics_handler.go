@@ -0,0 +1,13 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/burakiscoding/go-book-rent/metrics"
+)
+
+// HandleMetrics serves the Prometheus metrics
+func HandleMetrics(w http.ResponseWriter, r *http.Request) error {
+	metrics.Handler().ServeHTTP(w, r)
+	return nil
+}
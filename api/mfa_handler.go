@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+const recoveryCodeCount = 10
+
+type MFAHandler struct {
+	store           store.MFAStore
+	userStore       store.UserStore
+	sessionStore    store.SessionStore
+	throttler       *LoginThrottler
+	requireAdminMFA bool
+}
+
+func NewMFAHandler(store store.MFAStore, userStore store.UserStore, sessionStore store.SessionStore, throttler *LoginThrottler, requireAdminMFA bool) *MFAHandler {
+	return &MFAHandler{store: store, userStore: userStore, sessionStore: sessionStore, throttler: throttler, requireAdminMFA: requireAdminMFA}
+}
+
+func (h *MFAHandler) HandleEnroll(w http.ResponseWriter, r *http.Request) error {
+	tokenPayload, err := helpers.GetTokenPayloadFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	response, err := h.enroll(r.Context(), tokenPayload.Id)
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteJSON(w, http.StatusOK, response)
+}
+
+func (h *MFAHandler) HandleConfirm(w http.ResponseWriter, r *http.Request) error {
+	tokenPayload, err := helpers.GetTokenPayloadFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	var request types.MFACodeRequest
+	if err := helpers.DecodeRequest(r, &request); err != nil {
+		return err
+	}
+
+	codes, err := h.confirm(r.Context(), tokenPayload.Id, request.Code)
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteJSON(w, http.StatusOK, types.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *MFAHandler) HandleDisable(w http.ResponseWriter, r *http.Request) error {
+	tokenPayload, err := helpers.GetTokenPayloadFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	var request types.MFACodeRequest
+	if err := helpers.DecodeRequest(r, &request); err != nil {
+		return err
+	}
+
+	if h.requireAdminMFA && tokenPayload.Role == types.RoleAdmin {
+		return helpers.NewAPIError(helpers.CodeMFARequiredForAdmins, "mfa is required for admins")
+	}
+
+	mfa, err := h.store.GetByUserId(r.Context(), tokenPayload.Id)
+	if err == sql.ErrNoRows || (err == nil && !mfa.Enabled) {
+		return helpers.NewAPIError(helpers.CodeMFANotEnabled, "mfa is not enabled")
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, err := h.verify(r.Context(), mfa, request.Code)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return helpers.BadCredentials()
+	}
+
+	if err := h.store.Disable(r.Context(), tokenPayload.Id); err != nil {
+		return err
+	}
+
+	return helpers.WriteOK(w)
+}
+
+// HandleLoginEnroll starts the enrollment for users who must set up MFA before logging in
+func (h *MFAHandler) HandleLoginEnroll(w http.ResponseWriter, r *http.Request) error {
+	var request types.MFAEnrollmentRequest
+	if err := helpers.DecodeRequest(r, &request); err != nil {
+		return err
+	}
+
+	userId, err := helpers.GetMFATokenUserId(request.MFAToken)
+	if err != nil {
+		return err
+	}
+
+	response, err := h.enroll(r.Context(), userId)
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteJSON(w, http.StatusOK, response)
+}
+
+// HandleLoginVerify is the second login step. It accepts a TOTP code or a recovery code.
+// If the user was enrolling during login, the first valid code also confirms the enrollment.
+func (h *MFAHandler) HandleLoginVerify(w http.ResponseWriter, r *http.Request) error {
+	var request types.LoginMFARequest
+	if err := helpers.DecodeRequest(r, &request); err != nil {
+		return err
+	}
+
+	userId, err := helpers.GetMFATokenUserId(request.MFAToken)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.userStore.GetById(r.Context(), userId)
+	if err == sql.ErrNoRows {
+		return helpers.BadCredentials()
+	}
+	if err != nil {
+		return err
+	}
+
+	// Codes are guessed just like passwords
+	ip, now := helpers.ClientIP(r), time.Now()
+	wait, err := h.throttler.Attempt(r.Context(), user.Username, ip, now)
+	if err != nil {
+		return err
+	}
+
+	if wait > 0 {
+		return retryAfter(w, wait)
+	}
+
+	mfa, err := h.store.GetByUserId(r.Context(), userId)
+	if err == sql.ErrNoRows {
+		return helpers.BadCredentials()
+	}
+	if err != nil {
+		return err
+	}
+
+	var recoveryCodes []string
+	if mfa.Enabled {
+		ok, err := h.verify(r.Context(), mfa, request.Code)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return helpers.BadCredentials()
+		}
+	} else {
+		codes, err := h.confirm(r.Context(), userId, request.Code)
+		if err != nil {
+			return err
+		}
+		recoveryCodes = codes
+	}
+
+	if err := h.throttler.Success(r.Context(), user.Username, ip, now); err != nil {
+		return err
+	}
+
+	response, err := startSession(r, h.sessionStore, user)
+	if err != nil {
+		return err
+	}
+	response.RecoveryCodes = recoveryCodes
+
+	return helpers.WriteJSON(w, http.StatusOK, response)
+}
+
+func (h *MFAHandler) enroll(ctx context.Context, userId string) (types.MFAEnrollResponse, error) {
+	enabled, err := h.store.IsEnabled(ctx, userId)
+	if err != nil {
+		return types.MFAEnrollResponse{}, err
+	}
+
+	if enabled {
+		return types.MFAEnrollResponse{}, helpers.NewAPIError(helpers.CodeMFAAlreadyEnabled, "mfa is already enabled")
+	}
+
+	user, err := h.userStore.GetById(ctx, userId)
+	if err != nil {
+		return types.MFAEnrollResponse{}, err
+	}
+
+	secret, err := helpers.GenerateTOTPSecret()
+	if err != nil {
+		return types.MFAEnrollResponse{}, err
+	}
+
+	if err := h.store.SetPendingSecret(ctx, userId, secret); err != nil {
+		return types.MFAEnrollResponse{}, err
+	}
+
+	return types.MFAEnrollResponse{Secret: secret, URI: helpers.TOTPURI(secret, user.Username)}, nil
+}
+
+// confirm enables MFA after the first valid code and returns new recovery codes
+func (h *MFAHandler) confirm(ctx context.Context, userId, code string) ([]string, error) {
+	mfa, err := h.store.GetByUserId(ctx, userId)
+	if err == sql.ErrNoRows {
+		return nil, helpers.NewAPIError(helpers.CodeMFAEnrollmentNotStarted, "mfa enrollment not started")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if mfa.Enabled {
+		return nil, helpers.NewAPIError(helpers.CodeMFAAlreadyEnabled, "mfa is already enabled")
+	}
+
+	step, ok := helpers.ValidateTOTP(mfa.Secret, code, time.Now(), mfa.LastUsedStep)
+	if !ok {
+		return nil, helpers.BadCredentials()
+	}
+
+	codes, err := helpers.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = helpers.HashRecoveryCode(c)
+	}
+
+	if err := h.store.Enable(ctx, userId, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (h *MFAHandler) verify(ctx context.Context, mfa types.UserMFA, code string) (bool, error) {
+	if step, ok := helpers.ValidateTOTP(mfa.Secret, code, time.Now(), mfa.LastUsedStep); ok {
+		// Another request may have used the same code since mfa was read
+		return h.store.UseStep(ctx, mfa.UserId, step)
+	}
+
+	return h.store.UseRecoveryCode(ctx, mfa.UserId, helpers.HashRecoveryCode(code))
+}
@@ -2,52 +2,173 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
+	"database/sql"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
 	"github.com/burakiscoding/go-book-rent/types"
 )
 
-func HandleAuth(f helpers.APIFunc) helpers.APIFunc {
+// Last-seen time of a session is updated at most once per interval
+const sessionTouchInterval = time.Minute
+
+type AuthMiddleware struct {
+	roleStore    store.RoleStore
+	apiKeyStore  store.APIKeyStore
+	sessionStore store.SessionStore
+}
+
+func NewAuthMiddleware(roleStore store.RoleStore, apiKeyStore store.APIKeyStore, sessionStore store.SessionStore) *AuthMiddleware {
+	return &AuthMiddleware{roleStore: roleStore, apiKeyStore: apiKeyStore, sessionStore: sessionStore}
+}
+
+// HandleAuth accepts any user logged in with a Bearer token. API keys are refused,
+// they act as their creator and must not reach the routes of the user itself.
+// The role and permissions are loaded from the database so changes take effect without re-login.
+func (m *AuthMiddleware) HandleAuth(f helpers.APIFunc) helpers.APIFunc {
+	return m.authenticate(f, nil)
+}
+
+// AllowAPIKeys is HandleAuth that also accepts API keys with every given scope
+func (m *AuthMiddleware) AllowAPIKeys(f helpers.APIFunc, scopes ...string) helpers.APIFunc {
+	return m.authenticate(f, scopes)
+}
+
+// authenticate accepts a Bearer token, or an X-API-Key header when keyScopes are given and the key has them all
+func (m *AuthMiddleware) authenticate(f helpers.APIFunc, keyScopes []string) helpers.APIFunc {
 	return func(w http.ResponseWriter, r *http.Request) error {
-		tokenString, err := helpers.GetTokenFromHeader(r)
-		if err != nil {
-			return err
+		var userId, sessionId string
+		var scopes []string
+
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			apiKey, err := m.authenticateAPIKey(r.Context(), key)
+			if err != nil {
+				return err
+			}
+			if len(keyScopes) == 0 {
+				return helpers.NewAPIError(helpers.CodeForbidden, "api keys can't be used on this route")
+			}
+			for _, scope := range keyScopes {
+				if !slices.Contains(apiKey.Scopes, scope) {
+					return helpers.Forbidden()
+				}
+			}
+			userId = apiKey.CreatedBy
+			scopes = apiKey.Scopes
+		} else {
+			tokenString, err := helpers.GetTokenFromHeader(r)
+			if err != nil {
+				return err
+			}
+
+			tokenPayload, err := helpers.GetTokenPayload(tokenString)
+			if err != nil {
+				return err
+			}
+			userId = tokenPayload.Id
+			sessionId = tokenPayload.SessionId
+
+			if err := m.checkSession(r.Context(), sessionId, userId); err != nil {
+				return err
+			}
 		}
 
-		tokenPayload, err := helpers.GetTokenPayload(tokenString)
+		role, permissions, err := m.roleStore.GetUserRoleAndPermissions(r.Context(), userId)
+		if err == sql.ErrNoRows {
+			return helpers.BadCredentials()
+		}
 		if err != nil {
 			return err
 		}
 
-		if tokenPayload.Role != types.RoleUser && tokenPayload.Role != types.RoleAdmin {
-			return helpers.BadCredentials()
+		// API keys act as their creator, limited to their scopes
+		if scopes != nil {
+			permissions = slices.DeleteFunc(permissions, func(p string) bool {
+				return !slices.Contains(scopes, p)
+			})
 		}
 
-		ctx := context.WithValue(r.Context(), types.KeyId, tokenPayload.Id)
-		ctx = context.WithValue(ctx, types.KeyRole, tokenPayload.Role)
+		ctx := helpers.WithLogUser(r.Context(), userId)
+		ctx = context.WithValue(ctx, types.KeyId, userId)
+		ctx = context.WithValue(ctx, types.KeyRole, role)
+		ctx = context.WithValue(ctx, types.KeyPermissions, permissions)
+		ctx = context.WithValue(ctx, types.KeySessionId, sessionId)
 		return f(w, r.WithContext(ctx))
 	}
 }
 
-func HandleAdminAuth(f helpers.APIFunc) helpers.APIFunc {
-	return func(w http.ResponseWriter, r *http.Request) error {
-		tokenString, err := helpers.GetTokenFromHeader(r)
-		if err != nil {
-			return err
+// RequirePermission accepts authenticated users whose role has every given permission.
+// API keys need them as scopes too.
+func (m *AuthMiddleware) RequirePermission(f helpers.APIFunc, permissions ...string) helpers.APIFunc {
+	return m.authenticate(func(w http.ResponseWriter, r *http.Request) error {
+		for _, permission := range permissions {
+			if !helpers.HasPermission(r, permission) {
+				return helpers.Forbidden()
+			}
 		}
 
-		tokenPayload, err := helpers.GetTokenPayload(tokenString)
-		if err != nil {
-			return err
-		}
+		return f(w, r)
+	}, permissions)
+}
 
-		if tokenPayload.Role != types.RoleAdmin {
-			return helpers.BadCredentials()
-		}
+func (m *AuthMiddleware) authenticateAPIKey(ctx context.Context, key string) (types.APIKey, error) {
+	prefix, err := helpers.ParseAPIKeyPrefix(key)
+	if err != nil {
+		return types.APIKey{}, err
+	}
 
-		ctx := context.WithValue(r.Context(), types.KeyId, tokenPayload.Id)
-		ctx = context.WithValue(ctx, types.KeyRole, tokenPayload.Role)
-		return f(w, r.WithContext(ctx))
+	apiKey, err := m.apiKeyStore.GetByPrefix(ctx, prefix)
+	if err == sql.ErrNoRows {
+		return types.APIKey{}, helpers.BadCredentials()
+	}
+	if err != nil {
+		return types.APIKey{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(helpers.HashAPIKey(key)), []byte(apiKey.KeyHash)) != 1 {
+		return types.APIKey{}, helpers.BadCredentials()
+	}
+
+	if apiKey.RevokedAt != nil {
+		return types.APIKey{}, helpers.BadCredentials()
+	}
+
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return types.APIKey{}, helpers.BadCredentials()
+	}
+
+	if err := m.apiKeyStore.UpdateLastUsed(ctx, apiKey.Id); err != nil {
+		return types.APIKey{}, err
 	}
+
+	return apiKey, nil
+}
+
+// checkSession rejects tokens of sessions that were signed out
+func (m *AuthMiddleware) checkSession(ctx context.Context, sessionId, userId string) error {
+	if sessionId == "" {
+		return helpers.BadCredentials()
+	}
+
+	session, err := m.sessionStore.GetById(ctx, sessionId)
+	if err == sql.ErrNoRows {
+		return helpers.BadCredentials()
+	}
+	if err != nil {
+		return err
+	}
+
+	if session.UserId != userId || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return helpers.BadCredentials()
+	}
+
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		return m.sessionStore.Touch(ctx, sessionId)
+	}
+
+	return nil
 }
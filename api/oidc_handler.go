@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/oidc"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+const oidcStateCookie = "oidc_state"
+
+type OIDCHandler struct {
+	provider        *oidc.Provider
+	identityStore   store.IdentityStore
+	userStore       store.UserStore
+	mfaStore        store.MFAStore
+	sessionStore    store.SessionStore
+	requireAdminMFA bool
+}
+
+func NewOIDCHandler(provider *oidc.Provider, identityStore store.IdentityStore, userStore store.UserStore, mfaStore store.MFAStore, sessionStore store.SessionStore, requireAdminMFA bool) *OIDCHandler {
+	return &OIDCHandler{
+		provider:        provider,
+		identityStore:   identityStore,
+		userStore:       userStore,
+		mfaStore:        mfaStore,
+		sessionStore:    sessionStore,
+		requireAdminMFA: requireAdminMFA,
+	}
+}
+
+// HandleLogin redirects the browser to the identity provider
+func (h *OIDCHandler) HandleLogin(w http.ResponseWriter, r *http.Request) error {
+	state, nonce, verifier, err := oidc.NewAuthRequest()
+	if err != nil {
+		return err
+	}
+
+	stateToken, err := helpers.CreateOIDCStateToken(state, nonce, verifier)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateToken,
+		Path:     "/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, h.provider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+	return nil
+}
+
+// HandleCallback finishes the login like a password login, with the token or an MFA challenge
+func (h *OIDCHandler) HandleCallback(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		return helpers.BadCredentials()
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return helpers.BadCredentials()
+	}
+
+	state, nonce, verifier, err := helpers.GetOIDCState(cookie.Value)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 || query.Get("code") == "" {
+		return helpers.BadCredentials()
+	}
+
+	// The state can only be used once
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+
+	claims, err := h.provider.Exchange(r.Context(), query.Get("code"), verifier, nonce)
+	if err != nil {
+		return helpers.BadCredentials()
+	}
+
+	user, err := h.findOrCreateUser(r.Context(), claims)
+	if err != nil {
+		return err
+	}
+
+	// The provider replaces the password, not the second factor
+	return finishLogin(w, r, h.mfaStore, h.sessionStore, h.requireAdminMFA, user)
+}
+
+// findOrCreateUser uses an existing link, links a user with the same verified email
+// as username, or creates a new user without a password. Staff accounts are never linked
+// automatically, whoever controls the email at the provider would get their permissions.
+func (h *OIDCHandler) findOrCreateUser(ctx context.Context, claims oidc.Claims) (types.User, error) {
+	issuer := h.provider.Issuer()
+
+	userId, err := h.identityStore.GetUserId(ctx, issuer, claims.Subject)
+	if err == nil {
+		return h.userStore.GetById(ctx, userId)
+	}
+	if err != sql.ErrNoRows {
+		return types.User{}, err
+	}
+
+	if claims.EmailVerified && claims.Email != "" {
+		user, err := h.userStore.GetByUsername(ctx, claims.Email)
+		if err == nil && user.Role != types.RoleUser {
+			helpers.SecurityEvent(ctx, "oidc_link_refused", "user_id", user.Id, "issuer", issuer, "subject", claims.Subject)
+			return types.User{}, helpers.NewAPIError(helpers.CodeForbidden, "staff accounts are not linked automatically")
+		}
+		if err == nil {
+			return user, h.identityStore.Link(ctx, issuer, claims.Subject, user.Id)
+		}
+		if err != sql.ErrNoRows {
+			return types.User{}, err
+		}
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Email
+	}
+	if username == "" {
+		username = claims.Subject
+	}
+
+	available, err := h.userStore.IsUsernameAvailable(ctx, username)
+	if err != nil {
+		return types.User{}, err
+	}
+
+	if !available {
+		return types.User{}, helpers.UsernameTaken()
+	}
+
+	// Empty password never matches, these users can only log in through the provider
+	err = h.userStore.Insert(ctx, username, "", claims.GivenName, claims.FamilyName, types.RoleUser)
+	if err == store.ErrUsernameTaken {
+		return types.User{}, helpers.UsernameTaken()
+	}
+	if err != nil {
+		return types.User{}, err
+	}
+
+	user, err := h.userStore.GetByUsername(ctx, username)
+	if err != nil {
+		return types.User{}, err
+	}
+
+	return user, h.identityStore.Link(ctx, issuer, claims.Subject, user.Id)
+}
@@ -0,0 +1,490 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/oidc"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	testClientId     = "book-rent"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "http://localhost:8080/api/v1/auth/oidc/callback"
+	testKid          = "test-key"
+)
+
+// mockGrant is an authorization code handed out by the mock identity provider
+type mockGrant struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+	key       *rsa.PrivateKey
+}
+
+// mockIdP serves discovery, the JWKS and the token endpoint of an identity provider
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	issuer string
+
+	mu     sync.Mutex
+	grants map[string]mockGrant
+	nextId int
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{key: key, grants: make(map[string]mockGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.handleDiscovery)
+	mux.HandleFunc("/jwks", idp.handleJWKS)
+	mux.HandleFunc("/token", idp.handleToken)
+
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *mockIdP) provider(t *testing.T) *oidc.Provider {
+	t.Helper()
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:       idp.server.URL,
+		ClientId:     testClientId,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, idp.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return provider
+}
+
+func (idp *mockIdP) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 idp.issuer,
+		"authorization_endpoint": idp.server.URL + "/authorize",
+		"token_endpoint":         idp.server.URL + "/token",
+		"jwks_uri":               idp.server.URL + "/jwks",
+	})
+}
+
+func (idp *mockIdP) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kid": testKid,
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+// handleToken checks the client and the PKCE verifier and signs the ID token of the code
+func (idp *mockIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+
+	idp.mu.Lock()
+	grant, ok := idp.grants[r.PostForm.Get("code")]
+	// Codes can only be used once
+	delete(idp.grants, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok,
+		r.PostForm.Get("grant_type") != "authorization_code",
+		r.PostForm.Get("client_id") != testClientId,
+		r.PostForm.Get("client_secret") != testClientSecret,
+		r.PostForm.Get("redirect_uri") != testRedirectURL,
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge:
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   idp.issuer,
+		"aud":   testClientId,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute * 5).Unix(),
+		"nonce": grant.nonce,
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+
+	key := idp.key
+	if grant.key != nil {
+		key = grant.key
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKid
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		http.Error(w, `{"error":"server_error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+// authorize plays the authorization endpoint, the user logs in and gets redirected with a code
+func (idp *mockIdP) authorize(t *testing.T, location string, claims jwt.MapClaims, tamper func(*mockGrant)) (state, code string) {
+	t.Helper()
+
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/authorize" {
+		t.Fatalf("redirected to %s, expected the authorization endpoint", u.Path)
+	}
+
+	query := u.Query()
+	expected := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientId,
+		"redirect_uri":          testRedirectURL,
+		"code_challenge_method": "S256",
+	}
+	for k, v := range expected {
+		if query.Get(k) != v {
+			t.Fatalf("authorization request has %s=%q, expected %q", k, query.Get(k), v)
+		}
+	}
+	for _, k := range []string{"state", "nonce", "code_challenge"} {
+		if query.Get(k) == "" {
+			t.Fatalf("authorization request has no %s", k)
+		}
+	}
+	if !strings.Contains(query.Get("scope"), "openid") {
+		t.Fatalf("authorization request has scope %q, expected openid", query.Get("scope"))
+	}
+
+	grant := mockGrant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: claims}
+	if tamper != nil {
+		tamper(&grant)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.nextId++
+	code = "code-" + big.NewInt(int64(idp.nextId)).String()
+	idp.grants[code] = grant
+
+	return query.Get("state"), code
+}
+
+type oidcTest struct {
+	idp    *mockIdP
+	stores store.Stores
+	router *mux.Router
+}
+
+func newOIDCTest(t *testing.T, requireAdminMFA bool) *oidcTest {
+	t.Helper()
+
+	idp := newMockIdP(t)
+	stores := store.NewMemoryStores()
+	router := NewRouter(stores, RouterConfig{
+		RequireAdminMFA: requireAdminMFA,
+		OIDCProvider:    idp.provider(t),
+		Logger:          testLogger(),
+	})
+
+	return &oidcTest{idp: idp, stores: stores, router: router}
+}
+
+// login runs the whole flow, the browser is played by the test
+func (o *oidcTest) login(t *testing.T, claims jwt.MapClaims, tamper func(*mockGrant)) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	o.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login returned %d, expected %d", rec.Code, http.StatusFound)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie {
+		t.Fatalf("login set cookies %v, expected %s", cookies, oidcStateCookie)
+	}
+
+	state, code := o.idp.authorize(t, rec.Header().Get("Location"), claims, tamper)
+
+	return o.callback(t, cookies[0], url.Values{"state": {state}, "code": {code}})
+}
+
+func (o *oidcTest) callback(t *testing.T, cookie *http.Cookie, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	o.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func (o *oidcTest) insertUser(t *testing.T, username, role string) types.User {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := o.stores.Users.Insert(ctx, username, "", "", "", role); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := o.stores.Users.GetByUsername(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func (o *oidcTest) linkedUserId(t *testing.T, subject string) string {
+	t.Helper()
+
+	userId, err := o.stores.Identities.GetUserId(context.Background(), o.idp.issuer, subject)
+	if err != nil {
+		t.Fatalf("subject %s is not linked: %v", subject, err)
+	}
+
+	return userId
+}
+
+func decodeResponse[T any](t *testing.T, rec *httptest.ResponseRecorder, status int) T {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Fatalf("returned %d, expected %d: %s", rec.Code, status, rec.Body.String())
+	}
+
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func TestOIDCDiscoveryRejectsOtherIssuer(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.issuer = "https://idp.example.com"
+
+	_, err := oidc.NewProvider(context.Background(), oidc.Config{Issuer: idp.server.URL, ClientId: testClientId}, idp.server.Client())
+	if err == nil {
+		t.Fatal("provider accepted a discovery document of another issuer")
+	}
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	o := newOIDCTest(t, false)
+
+	rec := o.login(t, jwt.MapClaims{"sub": "alice-sub", "preferred_username": "alice", "given_name": "Alice", "family_name": "Smith"}, nil)
+	response := decodeResponse[types.LoginResponse](t, rec, http.StatusOK)
+	if response.Token == "" {
+		t.Fatal("login returned no token")
+	}
+
+	user, err := o.stores.Users.GetByUsername(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("user was not created: %v", err)
+	}
+	if user.Role != types.RoleUser || user.FirstName != "Alice" || user.LastName != "Smith" {
+		t.Fatalf("created user %+v, expected Alice Smith with role user", user)
+	}
+	if o.linkedUserId(t, "alice-sub") != user.Id {
+		t.Fatal("subject is linked to another user")
+	}
+
+	// The link wins over the claims on the next login
+	rec = o.login(t, jwt.MapClaims{"sub": "alice-sub", "preferred_username": "alice2"}, nil)
+	decodeResponse[types.LoginResponse](t, rec, http.StatusOK)
+
+	available, err := o.stores.Users.IsUsernameAvailable(context.Background(), "alice2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Fatal("second login created another user")
+	}
+}
+
+func TestOIDCLoginLinksVerifiedEmail(t *testing.T) {
+	o := newOIDCTest(t, false)
+	bob := o.insertUser(t, "bob@example.com", types.RoleUser)
+
+	rec := o.login(t, jwt.MapClaims{"sub": "bob-sub", "email": "bob@example.com", "email_verified": true, "preferred_username": "bobby"}, nil)
+	decodeResponse[types.LoginResponse](t, rec, http.StatusOK)
+
+	if o.linkedUserId(t, "bob-sub") != bob.Id {
+		t.Fatal("verified email was not linked to the existing user")
+	}
+}
+
+func TestOIDCLoginDoesNotLinkUnverifiedEmail(t *testing.T) {
+	o := newOIDCTest(t, false)
+	carol := o.insertUser(t, "carol@example.com", types.RoleUser)
+
+	rec := o.login(t, jwt.MapClaims{"sub": "carol-sub", "email": "carol@example.com", "email_verified": false, "preferred_username": "carol"}, nil)
+	decodeResponse[types.LoginResponse](t, rec, http.StatusOK)
+
+	if o.linkedUserId(t, "carol-sub") == carol.Id {
+		t.Fatal("unverified email was linked to the existing user")
+	}
+}
+
+func TestOIDCLoginRefusesToLinkStaff(t *testing.T) {
+	for _, role := range []string{types.RoleAdmin, types.RoleLibrarian} {
+		t.Run(role, func(t *testing.T) {
+			o := newOIDCTest(t, false)
+			o.insertUser(t, "staff@example.com", role)
+
+			rec := o.login(t, jwt.MapClaims{"sub": "staff-sub", "email": "staff@example.com", "email_verified": true}, nil)
+			problem := decodeResponse[helpers.APIError](t, rec, http.StatusForbidden)
+			if problem.Code != helpers.CodeForbidden {
+				t.Fatalf("returned code %s, expected %s", problem.Code, helpers.CodeForbidden)
+			}
+
+			if _, err := o.stores.Identities.GetUserId(context.Background(), o.idp.issuer, "staff-sub"); err == nil {
+				t.Fatal("staff account was linked")
+			}
+		})
+	}
+}
+
+func TestOIDCLoginRequiresMFA(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("enabled", func(t *testing.T) {
+		o := newOIDCTest(t, false)
+		user := o.insertUser(t, "erin", types.RoleUser)
+		if err := o.stores.Identities.Link(ctx, o.idp.issuer, "erin-sub", user.Id); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.stores.MFA.SetPendingSecret(ctx, user.Id, "secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.stores.MFA.Enable(ctx, user.Id, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		rec := o.login(t, jwt.MapClaims{"sub": "erin-sub"}, nil)
+		challenge := decodeResponse[types.MFAChallengeResponse](t, rec, http.StatusOK)
+		if !challenge.MFARequired || challenge.EnrollmentRequired || challenge.MFAToken == "" {
+			t.Fatalf("returned %+v, expected an MFA challenge", challenge)
+		}
+	})
+
+	t.Run("required for admins", func(t *testing.T) {
+		o := newOIDCTest(t, true)
+		admin := o.insertUser(t, "frank", types.RoleAdmin)
+		if err := o.stores.Identities.Link(ctx, o.idp.issuer, "frank-sub", admin.Id); err != nil {
+			t.Fatal(err)
+		}
+
+		rec := o.login(t, jwt.MapClaims{"sub": "frank-sub"}, nil)
+		challenge := decodeResponse[types.MFAChallengeResponse](t, rec, http.StatusOK)
+		if !challenge.MFARequired || !challenge.EnrollmentRequired || challenge.MFAToken == "" {
+			t.Fatalf("returned %+v, expected an MFA enrollment challenge", challenge)
+		}
+	})
+}
+
+func TestOIDCCallbackRejectsBadTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		tamper func(*mockGrant)
+	}{
+		{"wrong code verifier", jwt.MapClaims{}, func(g *mockGrant) { g.challenge = "not-the-challenge" }},
+		{"wrong audience", jwt.MapClaims{"aud": "another-client"}, nil},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://idp.example.com"}, nil},
+		{"wrong nonce", jwt.MapClaims{"nonce": "another-nonce"}, nil},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, nil},
+		{"no subject", jwt.MapClaims{"sub": ""}, nil},
+		{"wrong signature", jwt.MapClaims{}, func(g *mockGrant) { g.key = otherKey }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := newOIDCTest(t, false)
+			if _, ok := test.claims["sub"]; !ok {
+				test.claims["sub"] = "mallory-sub"
+			}
+
+			rec := o.login(t, test.claims, test.tamper)
+			problem := decodeResponse[helpers.APIError](t, rec, http.StatusUnauthorized)
+			if problem.Code != helpers.CodeUnauthorized {
+				t.Fatalf("returned code %s, expected %s", problem.Code, helpers.CodeUnauthorized)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsBadState(t *testing.T) {
+	o := newOIDCTest(t, false)
+
+	rec := httptest.NewRecorder()
+	o.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	cookie := rec.Result().Cookies()[0]
+	_, code := o.idp.authorize(t, rec.Header().Get("Location"), jwt.MapClaims{"sub": "mallory-sub"}, nil)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		query  url.Values
+	}{
+		{"no cookie", nil, url.Values{"state": {"state"}, "code": {code}}},
+		{"other state", cookie, url.Values{"state": {"another-state"}, "code": {code}}},
+		{"provider error", cookie, url.Values{"error": {"access_denied"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decodeResponse[helpers.APIError](t, o.callback(t, test.cookie, test.query), http.StatusUnauthorized)
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+//go:embed docs.html
+var docsHTML []byte
+
+// openAPIJSON converts the embedded spec once, on the first request
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	var spec any
+	if err := yaml.Unmarshal(openAPIYAML, &spec); err != nil {
+		return nil, err
+	}
+	return json.Marshal(spec)
+})
+
+// OpenAPISpec returns the OpenAPI document as JSON
+func OpenAPISpec() ([]byte, error) {
+	return openAPIJSON()
+}
+
+// HandleOpenAPI serves the OpenAPI document
+func HandleOpenAPI(w http.ResponseWriter, r *http.Request) error {
+	spec, err := openAPIJSON()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_, err = w.Write(spec)
+	return err
+}
+
+// HandleDocs serves a page that renders the OpenAPI document, it has no external assets
+func HandleDocs(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+	_, err := w.Write(docsHTML)
+	return err
+}
+
+// Types sent or received as JSON. Each one needs a schema whose x-go-type is its name.
+var openAPITypes = []any{
+	helpers.APIError{},
+	helpers.FieldError{},
+	helpers.JWKS{},
+	helpers.JWK{},
+	HealthResponse{},
+	HealthCheckResult{},
+	types.Book{},
+	types.AddBookRequest{},
+	types.AddStockRequest{},
+	types.UpdateBookRequest{},
+	types.User{},
+	types.RegisterUserRequest{},
+	types.LoginUserRequest{},
+	types.LoginResponse{},
+	types.MFAChallengeResponse{},
+	types.LoginMFARequest{},
+	types.MFAEnrollmentRequest{},
+	types.MFAEnrollResponse{},
+	types.MFACodeRequest{},
+	types.RecoveryCodesResponse{},
+	types.RefreshTokenRequest{},
+	types.Session{},
+	types.RentBookRequest{},
+	types.ReturnBookRequest{},
+	types.RentHistory{},
+	types.UserRentHistory{},
+	types.Role{},
+	types.UpdateUserRoleRequest{},
+	types.PermissionRequest{},
+	types.APIKey{},
+	types.APIKeyResponse{},
+	types.CreateAPIKeyRequest{},
+	types.DataExport{},
+	types.EraseAccountRequest{},
+}
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "patch", "head", "options"}
+
+type openAPIDocument struct {
+	Paths      map[string]map[string]any `yaml:"paths"`
+	Components struct {
+		Schemas map[string]*openAPISchema `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `yaml:"$ref"`
+	Type       any                       `yaml:"type"`
+	GoType     string                    `yaml:"x-go-type"`
+	Properties map[string]*openAPISchema `yaml:"properties"`
+	Items      *openAPISchema            `yaml:"items"`
+	Required   []string                  `yaml:"required"`
+	Enum       []string                  `yaml:"enum"`
+}
+
+// CheckOpenAPI compares the spec with the router and the Go types.
+// It reports routes missing on either side, schemas whose properties
+// or types differ from the JSON encoding of their x-go-type, and request
+// schemas whose required properties differ from the validate tags, and
+// an ErrorCode enum that differs from helpers.ErrorCodes.
+func CheckOpenAPI(router *mux.Router) []error {
+	var doc openAPIDocument
+	if err := yaml.Unmarshal(openAPIYAML, &doc); err != nil {
+		return []error{err}
+	}
+
+	errs := checkRoutes(router, doc)
+	errs = append(errs, checkSchemas(doc)...)
+	errs = append(errs, checkErrorCodes(doc)...)
+	return errs
+}
+
+func checkRoutes(router *mux.Router, doc openAPIDocument) []error {
+	var errs []error
+
+	registered := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouter prefixes have no methods
+			return nil
+		}
+		for _, method := range methods {
+			registered[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return []error{err}
+	}
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths {
+		for key := range item {
+			if slices.Contains(openAPIMethods, key) {
+				documented[strings.ToUpper(key)+" "+path] = true
+			}
+		}
+	}
+
+	for _, route := range sortedKeys(registered) {
+		if !documented[route] {
+			errs = append(errs, fmt.Errorf("route %s is not in the spec", route))
+		}
+	}
+	for _, route := range sortedKeys(documented) {
+		if !registered[route] {
+			errs = append(errs, fmt.Errorf("spec has %s but no such route is registered", route))
+		}
+	}
+
+	return errs
+}
+
+func checkSchemas(doc openAPIDocument) []error {
+	var errs []error
+	schemas := doc.Components.Schemas
+
+	goTypes := make(map[string]reflect.Type, len(openAPITypes))
+	for _, v := range openAPITypes {
+		t := reflect.TypeOf(v)
+		goTypes[t.String()] = t
+	}
+
+	covered := map[string]bool{}
+	for _, name := range sortedKeys(schemas) {
+		schema := schemas[name]
+		if schema.GoType == "" {
+			continue
+		}
+		t, ok := goTypes[schema.GoType]
+		if !ok {
+			errs = append(errs, fmt.Errorf("schema %s: unknown x-go-type %s", name, schema.GoType))
+			continue
+		}
+		covered[schema.GoType] = true
+		errs = append(errs, compareSchema(name, schema, t, schemas)...)
+		errs = append(errs, compareRequired(name, schema, t)...)
+	}
+
+	for _, name := range sortedKeys(goTypes) {
+		if !covered[name] {
+			errs = append(errs, fmt.Errorf("%s has no schema with that x-go-type", name))
+		}
+	}
+
+	return errs
+}
+
+func checkErrorCodes(doc openAPIDocument) []error {
+	schema, ok := doc.Components.Schemas["ErrorCode"]
+	if !ok {
+		return []error{fmt.Errorf("schema ErrorCode is missing")}
+	}
+
+	var errs []error
+	codes := helpers.ErrorCodes()
+	for _, code := range codes {
+		if !slices.Contains(schema.Enum, code) {
+			errs = append(errs, fmt.Errorf("ErrorCode: %s is missing from the enum", code))
+		}
+	}
+	for _, code := range schema.Enum {
+		if !slices.Contains(codes, code) {
+			errs = append(errs, fmt.Errorf("ErrorCode: %s is not an error code of helpers", code))
+		}
+	}
+	return errs
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// compareSchema checks a schema against a Go type, following $ref into other schemas
+func compareSchema(path string, schema *openAPISchema, t reflect.Type, schemas map[string]*openAPISchema) []error {
+	nullable := false
+	if t.Kind() == reflect.Pointer {
+		nullable = true
+		t = t.Elem()
+	}
+
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		target, ok := schemas[name]
+		if !ok {
+			return []error{fmt.Errorf("%s: unresolved $ref %s", path, schema.Ref)}
+		}
+		if target.GoType != "" {
+			// Compared on its own in checkSchemas
+			if target.GoType != t.String() {
+				return []error{fmt.Errorf("%s: refers to %s (%s), the field is %s", path, name, target.GoType, t)}
+			}
+			return nil
+		}
+		return compareSchema(path, target, t, schemas)
+	}
+
+	var errs []error
+	want := jsonType(t)
+	allowed := schemaTypes(schema)
+	if !slices.Contains(allowed, want) {
+		errs = append(errs, fmt.Errorf("%s: type is %v, the Go field encodes as %s", path, schema.Type, want))
+	}
+	if nullable && !slices.Contains(allowed, "null") {
+		errs = append(errs, fmt.Errorf("%s: pointer field can be null, add \"null\" to the type", path))
+	}
+
+	switch want {
+	case "array":
+		if schema.Items != nil {
+			errs = append(errs, compareSchema(path+"[]", schema.Items, t.Elem(), schemas)...)
+		}
+	case "object":
+		if t.Kind() != reflect.Struct {
+			return errs
+		}
+		fields := jsonFields(t)
+		for _, name := range sortedKeys(fields) {
+			property, ok := schema.Properties[name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: property %s is missing", path, name))
+				continue
+			}
+			errs = append(errs, compareSchema(path+"."+name, property, fields[name], schemas)...)
+		}
+		for _, name := range sortedKeys(schema.Properties) {
+			if _, ok := fields[name]; !ok {
+				errs = append(errs, fmt.Errorf("%s: property %s is not a field of %s", path, name, t))
+			}
+		}
+	}
+
+	return errs
+}
+
+// compareRequired checks the required properties of types with validate tags
+func compareRequired(path string, schema *openAPISchema, t reflect.Type) []error {
+	validated := false
+	required := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		validated = true
+		if slices.Contains(strings.Split(tag, ","), "required") {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			required[name] = true
+		}
+	}
+	if !validated {
+		return nil
+	}
+
+	var errs []error
+	for _, name := range sortedKeys(required) {
+		if !slices.Contains(schema.Required, name) {
+			errs = append(errs, fmt.Errorf("%s: %s is validated as required but not listed in required", path, name))
+		}
+	}
+	for _, name := range schema.Required {
+		if !required[name] {
+			errs = append(errs, fmt.Errorf("%s: %s is listed in required but has no required rule", path, name))
+		}
+	}
+	return errs
+}
+
+// jsonFields returns the fields encoding/json writes, by name, including promoted fields of embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embeddedName, embeddedType := range jsonFields(field.Type) {
+				if _, ok := fields[embeddedName]; !ok {
+					fields[embeddedName] = embeddedType
+				}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func jsonType(t reflect.Type) string {
+	if t == timeType {
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// schemaTypes returns the types a schema allows, "type" is a string or a list in OpenAPI 3.1
+func schemaTypes(schema *openAPISchema) []string {
+	switch v := schema.Type.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var types []string
+		for _, t := range v {
+			if s, ok := t.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/burakiscoding/go-book-rent/oidc"
+	"github.com/burakiscoding/go-book-rent/store"
+)
+
+// Every optional route is enabled, like in "book-rent openapi check"
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	stores := store.NewMemoryStores()
+	router := NewRouter(stores, RouterConfig{
+		SetupHandler: NewSetupHandler(stores.Users),
+		OIDCProvider: &oidc.Provider{},
+		Logger:       testLogger(),
+	})
+
+	for _, err := range CheckOpenAPI(router) {
+		t.Error(err)
+	}
+}
+
+func TestOpenAPIReportsMissingRoutes(t *testing.T) {
+	// Without the optional routes the spec documents routes that don't exist
+	stores := store.NewMemoryStores()
+	errs := CheckOpenAPI(NewRouter(stores, RouterConfig{Logger: testLogger()}))
+
+	for _, route := range []string{"POST /api/v1/setup/admin", "GET /api/v1/auth/oidc/login", "GET /api/v1/auth/oidc/callback"} {
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err.Error(), route)
+		}
+		if !found {
+			t.Errorf("missing route %s was not reported", route)
+		}
+	}
+}
+
+func TestOpenAPISpecIsJSON(t *testing.T) {
+	spec, err := OpenAPISpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		OpenAPI string         `json:"openapi"`
+		Paths   map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI == "" || len(doc.Paths) == 0 {
+		t.Fatalf("spec has openapi %q and %d paths", doc.OpenAPI, len(doc.Paths))
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/gorilla/mux"
+)
+
+// reauthenticationWindow is how long after a login the own account can be erased without the password
+const reauthenticationWindow = time.Minute * 5
+
+// PrivacyHandler serves data subject requests: export and erasure of personal data
+type PrivacyHandler struct {
+	userStore    store.UserStore
+	rentStore    store.RentStore
+	sessionStore store.SessionStore
+	mfaStore     store.MFAStore
+	throttler    *LoginThrottler
+}
+
+func NewPrivacyHandler(userStore store.UserStore, rentStore store.RentStore, sessionStore store.SessionStore, mfaStore store.MFAStore, throttler *LoginThrottler) *PrivacyHandler {
+	return &PrivacyHandler{userStore: userStore, rentStore: rentStore, sessionStore: sessionStore, mfaStore: mfaStore, throttler: throttler}
+}
+
+// HandleExport returns everything stored about the user, as JSON or as a ZIP with ?format=zip
+func (h *PrivacyHandler) HandleExport(w http.ResponseWriter, r *http.Request) error {
+	tokenPayload, err := helpers.GetTokenPayloadFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	export, err := h.export(r.Context(), tokenPayload.Id)
+	if err != nil {
+		return err
+	}
+
+	if r.URL.Query().Get("format") != "zip" {
+		return helpers.WriteJSON(w, http.StatusOK, export)
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="book-rent-export.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+	files := map[string]any{
+		"profile.json":      export.Profile,
+		"rent_history.json": export.RentHistory,
+		"sessions.json":     export.Sessions,
+		"security.json":     map[string]bool{"mfa_enabled": export.MFAEnabled},
+	}
+	for name, v := range files {
+		file, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// HandleErase erases the account of the caller, who has to prove it's still them, see reauthenticate
+func (h *PrivacyHandler) HandleErase(w http.ResponseWriter, r *http.Request) error {
+	tokenPayload, err := helpers.GetTokenPayloadFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	// The body is optional, a fresh session is enough
+	var request types.EraseAccountRequest
+	if r.ContentLength != 0 {
+		if err := helpers.DecodeRequest(r, &request); err != nil {
+			return err
+		}
+	}
+
+	if err := h.reauthenticate(w, r, tokenPayload, request.Password); err != nil {
+		return err
+	}
+
+	return h.erase(w, r, tokenPayload.Id)
+}
+
+func (h *PrivacyHandler) HandleEraseUser(w http.ResponseWriter, r *http.Request) error {
+	return h.erase(w, r, mux.Vars(r)["id"])
+}
+
+func (h *PrivacyHandler) export(ctx context.Context, userId string) (types.DataExport, error) {
+	user, err := h.userStore.GetById(ctx, userId)
+	if err != nil {
+		return types.DataExport{}, err
+	}
+	user.Password = ""
+
+	history, err := h.rentStore.GetUserHistory(ctx, userId)
+	if err != nil {
+		return types.DataExport{}, err
+	}
+
+	// Revoked and expired sessions are personal data too, they have the IPs and user agents
+	sessions, err := h.sessionStore.GetAllByUserId(ctx, userId)
+	if err != nil {
+		return types.DataExport{}, err
+	}
+
+	mfaEnabled, err := h.mfaStore.IsEnabled(ctx, userId)
+	if err != nil {
+		return types.DataExport{}, err
+	}
+
+	return types.DataExport{
+		ExportedAt:  time.Now(),
+		Profile:     user,
+		MFAEnabled:  mfaEnabled,
+		RentHistory: history,
+		Sessions:    sessions,
+	}, nil
+}
+
+// reauthenticate accepts the password of the user, or a session that logged in moments ago.
+// Users without a password, who log in through the identity provider, can only do the latter.
+func (h *PrivacyHandler) reauthenticate(w http.ResponseWriter, r *http.Request, tokenPayload types.TokenPayload, password string) error {
+	user, err := h.userStore.GetById(r.Context(), tokenPayload.Id)
+	if err != nil {
+		return err
+	}
+
+	if password == "" || user.Password == "" {
+		session, err := h.sessionStore.GetById(r.Context(), tokenPayload.SessionId)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		if err == nil && time.Since(session.CreatedAt) <= reauthenticationWindow {
+			return nil
+		}
+
+		return helpers.NewAPIError(helpers.CodeReauthenticationRequired, "confirm with your password or log in again")
+	}
+
+	// The password is guessed like on the login
+	ip, now := helpers.ClientIP(r), time.Now()
+	wait, err := h.throttler.Attempt(r.Context(), user.Username, ip, now)
+	if err != nil {
+		return err
+	}
+
+	if wait > 0 {
+		return retryAfter(w, wait)
+	}
+
+	if !helpers.CheckHashedPassword(user.Password, password) {
+		return helpers.BadCredentials()
+	}
+
+	return h.throttler.Success(r.Context(), user.Username, ip, now)
+}
+
+func (h *PrivacyHandler) erase(w http.ResponseWriter, r *http.Request, userId string) error {
+	if userId == types.TombstoneUserId {
+		return helpers.InvalidRequestData()
+	}
+
+	// The store checks for open loans in the same transaction, books must be returned
+	// first, otherwise nobody is left to return them
+	err := h.userStore.Erase(r.Context(), userId)
+	if err == sql.ErrNoRows {
+		return helpers.UserNotFound()
+	}
+	if err == store.ErrOpenLoans {
+		return helpers.NewAPIError(helpers.CodeOpenLoans, "return all rented books before erasing the account")
+	}
+	if err != nil {
+		return err
+	}
+
+	helpers.SecurityEvent(r.Context(), "account_erased", "user_id", userId)
+
+	return helpers.WriteOK(w)
+}
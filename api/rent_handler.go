@@ -1,21 +1,36 @@
 package api
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/metrics"
 	"github.com/burakiscoding/go-book-rent/store"
 	"github.com/burakiscoding/go-book-rent/types"
 )
 
+// RentalPolicy limits how long a book can be rented
+type RentalPolicy struct {
+	MinDays int
+	MaxDays int
+}
+
+func DefaultRentalPolicy() RentalPolicy {
+	return RentalPolicy{MinDays: types.MinRentTimeInDays, MaxDays: types.MaxRentTimeInDays}
+}
+
 type RentHandler struct {
 	store     store.RentStore
 	bookStore store.BookStore
+	userStore store.UserStore
+	policy    RentalPolicy
 }
 
-func NewRentHandler(store store.RentStore, bookStore store.BookStore) *RentHandler {
-	return &RentHandler{store: store, bookStore: bookStore}
+func NewRentHandler(store store.RentStore, bookStore store.BookStore, userStore store.UserStore, policy RentalPolicy) *RentHandler {
+	return &RentHandler{store: store, bookStore: bookStore, userStore: userStore, policy: policy}
 }
 
 func (h *RentHandler) HandleRentBook(w http.ResponseWriter, r *http.Request) error {
@@ -25,29 +40,75 @@ func (h *RentHandler) HandleRentBook(w http.ResponseWriter, r *http.Request) err
 	}
 
 	var request types.RentBookRequest
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		return helpers.InvalidJSON()
+	if err := helpers.DecodeJSON(r, &request); err != nil {
+		metrics.RentalFailed(metrics.ReasonInvalidRequest)
+		return err
 	}
 
-	if request.BookId == 0 ||
-		request.DurationInDays < types.MinRentTimeInDays ||
-		request.DurationInDays > types.MaxRentTimeInDays {
-		return helpers.InvalidRequestData()
+	// The tags have the limits of the API, the config can only narrow them
+	var durationErrs []helpers.FieldError
+	duration := request.DurationInDays
+	if duration >= types.MinRentTimeInDays && duration <= types.MaxRentTimeInDays && (duration < h.policy.MinDays || duration > h.policy.MaxDays) {
+		durationErrs = append(durationErrs, helpers.FieldError{
+			Field:  "duration_in_days",
+			Reason: fmt.Sprintf("must be between %d and %d", h.policy.MinDays, h.policy.MaxDays),
+		})
+	}
+	if err := helpers.Validate(request, durationErrs...); err != nil {
+		metrics.RentalFailed(metrics.ReasonInvalidRequest)
+		return err
 	}
 
-	book, err := h.bookStore.GetById(request.BookId)
+	// Renting on behalf of another user is reserved for staff
+	userId := tokenPayload.Id
+	if request.UserId != "" && request.UserId != tokenPayload.Id {
+		if !helpers.HasPermission(r, types.PermLoansCheckoutForOthers) {
+			metrics.RentalFailed(metrics.ReasonForbidden)
+			return helpers.Forbidden()
+		}
+
+		// The SQL schema has no foreign keys, the user has to be checked here
+		user, err := h.userStore.GetById(r.Context(), request.UserId)
+		if err == sql.ErrNoRows || (err == nil && user.Id == types.TombstoneUserId) {
+			metrics.RentalFailed(metrics.ReasonUserNotFound)
+			return helpers.UserNotFound()
+		}
+		if err != nil {
+			metrics.RentalFailed(metrics.ReasonError)
+			return err
+		}
+		if user.SuspendedAt != nil {
+			metrics.RentalFailed(metrics.ReasonForbidden)
+			return helpers.AccountSuspended()
+		}
+		userId = user.Id
+	}
+
+	book, err := h.bookStore.GetById(r.Context(), request.BookId)
+	if err == sql.ErrNoRows {
+		metrics.RentalFailed(metrics.ReasonBookNotFound)
+		return helpers.BookNotFound()
+	}
 	if err != nil {
+		metrics.RentalFailed(metrics.ReasonError)
 		return err
 	}
 
 	if book.Quantity <= 0 {
-		return helpers.NotFoundData()
+		metrics.RentalFailed(metrics.ReasonOutOfStock)
+		return helpers.OutOfStock()
 	}
 
-	if err := h.store.RentBook(r.Context(), request.BookId, tokenPayload.Id, request.DurationInDays); err != nil {
+	if err := h.store.RentBook(r.Context(), request.BookId, userId, request.DurationInDays); err != nil {
+		if errors.Is(err, store.ErrOutOfStock) {
+			metrics.RentalFailed(metrics.ReasonOutOfStock)
+			return helpers.OutOfStock()
+		}
+		metrics.RentalFailed(metrics.ReasonError)
 		return err
 	}
 
+	metrics.Rented()
 	return helpers.WriteOK(w)
 }
 
@@ -58,38 +119,41 @@ func (h *RentHandler) HandleReturnBook(w http.ResponseWriter, r *http.Request) e
 	}
 
 	var request types.ReturnBookRequest
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		return helpers.InvalidJSON()
+	if err := helpers.DecodeRequest(r, &request); err != nil {
+		return err
 	}
 
-	if request.Id == "" {
-		return helpers.InvalidRequestData()
+	history, err := h.store.GetHistoryById(r.Context(), request.Id)
+	if err == sql.ErrNoRows {
+		return helpers.LoanNotFound()
 	}
-
-	history, err := h.store.GetHistoryById(request.Id)
 	if err != nil {
 		return err
 	}
 
 	// It's not your rent history
-	if history.UserId != tokenPayload.Id {
-		return helpers.BadCredentials()
+	if history.UserId != tokenPayload.Id && !helpers.HasPermission(r, types.PermLoansManage) {
+		return helpers.Forbidden()
 	}
 
-	// Book already returned
+	// The store checks it again in the transaction, this only saves the round trip
 	if history.RentReturnTime != nil {
-		return helpers.NotFoundData()
+		return helpers.LoanAlreadyReturned()
 	}
 
 	if err := h.store.ReturnBook(r.Context(), request.Id); err != nil {
+		if errors.Is(err, store.ErrLoanAlreadyReturned) {
+			return helpers.LoanAlreadyReturned()
+		}
 		return err
 	}
 
+	metrics.Returned()
 	return helpers.WriteOK(w)
 }
 
 func (h *RentHandler) HandleGetAllHistory(w http.ResponseWriter, r *http.Request) error {
-	history, err := h.store.GetAllHistory()
+	history, err := h.store.GetAllHistory(r.Context())
 	if err != nil {
 		return err
 	}
@@ -103,7 +167,7 @@ func (h *RentHandler) HandleGetUserHistory(w http.ResponseWriter, r *http.Reques
 		return err
 	}
 
-	history, err := h.store.GetUserHistory(tokenPayload.Id)
+	history, err := h.store.GetUserHistory(r.Context(), tokenPayload.Id)
 	if err != nil {
 		return err
 	}
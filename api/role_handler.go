@@ -0,0 +1,102 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/gorilla/mux"
+)
+
+type RoleHandler struct {
+	store     store.RoleStore
+	userStore store.UserStore
+}
+
+func NewRoleHandler(store store.RoleStore, userStore store.UserStore) *RoleHandler {
+	return &RoleHandler{store: store, userStore: userStore}
+}
+
+func (h *RoleHandler) HandleGetAll(w http.ResponseWriter, r *http.Request) error {
+	roles, err := h.store.GetAll(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteJSON(w, http.StatusOK, roles)
+}
+
+func (h *RoleHandler) HandleGrantPermission(w http.ResponseWriter, r *http.Request) error {
+	role := mux.Vars(r)["name"]
+
+	var request types.PermissionRequest
+	if err := helpers.DecodeRequest(r, &request); err != nil {
+		return err
+	}
+
+	exists, err := h.store.Exists(r.Context(), role)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return helpers.RoleNotFound()
+	}
+
+	if err := h.store.GrantPermission(r.Context(), role, request.Permission); err != nil {
+		return err
+	}
+
+	return helpers.WriteOK(w)
+}
+
+func (h *RoleHandler) HandleRevokePermission(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+
+	exists, err := h.store.Exists(r.Context(), vars["name"])
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return helpers.RoleNotFound()
+	}
+
+	if err := h.store.RevokePermission(r.Context(), vars["name"], vars["permission"]); err != nil {
+		return err
+	}
+
+	return helpers.WriteOK(w)
+}
+
+func (h *RoleHandler) HandleUpdateUserRole(w http.ResponseWriter, r *http.Request) error {
+	id := mux.Vars(r)["id"]
+
+	var request types.UpdateUserRoleRequest
+	if err := helpers.DecodeRequest(r, &request); err != nil {
+		return err
+	}
+
+	exists, err := h.store.Exists(r.Context(), request.Role)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return helpers.ValidationFailed(helpers.FieldError{Field: "role", Reason: "is not a role"})
+	}
+
+	if _, err := h.userStore.GetById(r.Context(), id); err == sql.ErrNoRows {
+		return helpers.UserNotFound()
+	} else if err != nil {
+		return err
+	}
+
+	if err := h.userStore.UpdateRole(r.Context(), id, request.Role); err != nil {
+		return err
+	}
+
+	return helpers.WriteOK(w)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/oidc"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/gorilla/mux"
+)
+
+type RouterConfig struct {
+	RequireAdminMFA bool
+	// Zero values keep the defaults
+	Rental          RentalPolicy
+	LoginWindow     time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// Optional, nil disables the route
+	SetupHandler *SetupHandler
+	OIDCProvider *oidc.Provider
+	// Optional, nil serves the probes without any checks
+	Health *HealthHandler
+	// Base of the request loggers, nil uses slog.Default()
+	Logger *slog.Logger
+}
+
+// NewRouter registers every route on top of the given stores
+func NewRouter(stores store.Stores, config RouterConfig) *mux.Router {
+	router := mux.NewRouter()
+	subrouter := router.PathPrefix("/api/v1").Subrouter()
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	// Tracing runs first so request logs carry the trace id
+	requestLogger := RequestLogger(logger)
+	router.Use(TraceRequests, requestLogger)
+	// Middlewares only run on matched routes
+	router.NotFoundHandler = TraceRequests(requestLogger(helpers.MakeHandler(func(w http.ResponseWriter, r *http.Request) error {
+		return helpers.NotFoundData()
+	})))
+	router.MethodNotAllowedHandler = TraceRequests(requestLogger(helpers.MakeHandler(func(w http.ResponseWriter, r *http.Request) error {
+		return helpers.MethodNotAllowed()
+	})))
+
+	router.HandleFunc("/.well-known/jwks.json", helpers.MakeHandler(HandleJWKS)).Methods(http.MethodGet)
+
+	health := config.Health
+	if health == nil {
+		health = NewHealthHandler(time.Second * 2)
+	}
+	router.HandleFunc("/healthz", helpers.MakeHandler(health.HandleLiveness)).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", helpers.MakeHandler(health.HandleReadiness)).Methods(http.MethodGet)
+
+	auth := NewAuthMiddleware(stores.Roles, stores.APIKeys, stores.Sessions)
+
+	// Scrapers use an API key with the metrics:read scope, see also the metrics.addr setting
+	router.HandleFunc("/metrics", helpers.MakeHandler(auth.RequirePermission(HandleMetrics, types.PermMetricsRead))).Methods(http.MethodGet)
+	throttler := NewLoginThrottler(stores.LoginAttempts)
+	if config.LoginWindow > 0 {
+		throttler.Window = config.LoginWindow
+	}
+	if config.LockoutAfter > 0 {
+		throttler.LockoutAfter = config.LockoutAfter
+	}
+	if config.LockoutDuration > 0 {
+		throttler.LockoutDuration = config.LockoutDuration
+	}
+
+	rental := config.Rental
+	if rental == (RentalPolicy{}) {
+		rental = DefaultRentalPolicy()
+	}
+
+	subrouter.HandleFunc("/openapi.json", helpers.MakeHandler(HandleOpenAPI)).Methods(http.MethodGet)
+	subrouter.HandleFunc("/docs", helpers.MakeHandler(HandleDocs)).Methods(http.MethodGet)
+
+	bookHandler := NewBookHandler(stores.Books)
+	subrouter.HandleFunc("/books", helpers.MakeHandler(bookHandler.HandleGetAll)).Methods(http.MethodGet)
+	subrouter.HandleFunc("/books/{id}", helpers.MakeHandler(bookHandler.HandleGetById)).Methods(http.MethodGet)
+	subrouter.HandleFunc("/books", helpers.MakeHandler(auth.RequirePermission(bookHandler.HandleInsert, types.PermBooksWrite))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/books/{id}", helpers.MakeHandler(auth.RequirePermission(bookHandler.HandleUpdate, types.PermBooksWrite))).Methods(http.MethodPut)
+	subrouter.HandleFunc("/books/{id}", helpers.MakeHandler(auth.RequirePermission(bookHandler.HandleDelete, types.PermBooksWrite))).Methods(http.MethodDelete)
+	subrouter.HandleFunc("/books/{id}/stock", helpers.MakeHandler(auth.RequirePermission(bookHandler.HandleAddStock, types.PermBooksWrite))).Methods(http.MethodPost)
+
+	userHandler := NewUserHandler(stores.Users, stores.MFA, stores.Sessions, throttler, config.RequireAdminMFA)
+	subrouter.HandleFunc("/user/register", helpers.MakeHandler(userHandler.HandleRegister)).Methods(http.MethodPost)
+	subrouter.HandleFunc("/user/login", helpers.MakeHandler(userHandler.HandleLogin)).Methods(http.MethodPost)
+	subrouter.HandleFunc("/user/details", helpers.MakeHandler(auth.HandleAuth(userHandler.HandleGetDetails))).Methods(http.MethodPost)
+
+	mfaHandler := NewMFAHandler(stores.MFA, stores.Users, stores.Sessions, throttler, config.RequireAdminMFA)
+	subrouter.HandleFunc("/user/login/mfa", helpers.MakeHandler(mfaHandler.HandleLoginVerify)).Methods(http.MethodPost)
+	subrouter.HandleFunc("/user/login/mfa/enroll", helpers.MakeHandler(mfaHandler.HandleLoginEnroll)).Methods(http.MethodPost)
+	subrouter.HandleFunc("/user/mfa/enroll", helpers.MakeHandler(auth.HandleAuth(mfaHandler.HandleEnroll))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/user/mfa/confirm", helpers.MakeHandler(auth.HandleAuth(mfaHandler.HandleConfirm))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/user/mfa/disable", helpers.MakeHandler(auth.HandleAuth(mfaHandler.HandleDisable))).Methods(http.MethodPost)
+
+	sessionHandler := NewSessionHandler(stores.Sessions, stores.Users)
+	subrouter.HandleFunc("/user/token/refresh", helpers.MakeHandler(sessionHandler.HandleRefresh)).Methods(http.MethodPost)
+	subrouter.HandleFunc("/user/sessions", helpers.MakeHandler(auth.HandleAuth(sessionHandler.HandleGetAll))).Methods(http.MethodGet)
+	subrouter.HandleFunc("/user/sessions", helpers.MakeHandler(auth.HandleAuth(sessionHandler.HandleDeleteAll))).Methods(http.MethodDelete)
+	subrouter.HandleFunc("/user/sessions/{id}", helpers.MakeHandler(auth.HandleAuth(sessionHandler.HandleDelete))).Methods(http.MethodDelete)
+	subrouter.HandleFunc("/users/{id}/sessions", helpers.MakeHandler(auth.RequirePermission(sessionHandler.HandleGetUserSessions, types.PermUsersManage))).Methods(http.MethodGet)
+	subrouter.HandleFunc("/users/{id}/sessions", helpers.MakeHandler(auth.RequirePermission(sessionHandler.HandleDeleteAllUserSessions, types.PermUsersManage))).Methods(http.MethodDelete)
+	subrouter.HandleFunc("/users/{id}/sessions/{session_id}", helpers.MakeHandler(auth.RequirePermission(sessionHandler.HandleDeleteUserSession, types.PermUsersManage))).Methods(http.MethodDelete)
+
+	if config.SetupHandler != nil {
+		subrouter.HandleFunc("/setup/admin", helpers.MakeHandler(config.SetupHandler.HandleCreateAdmin)).Methods(http.MethodPost)
+	}
+
+	if config.OIDCProvider != nil {
+		oidcHandler := NewOIDCHandler(config.OIDCProvider, stores.Identities, stores.Users, stores.MFA, stores.Sessions, config.RequireAdminMFA)
+		subrouter.HandleFunc("/auth/oidc/login", helpers.MakeHandler(oidcHandler.HandleLogin)).Methods(http.MethodGet)
+		subrouter.HandleFunc("/auth/oidc/callback", helpers.MakeHandler(oidcHandler.HandleCallback)).Methods(http.MethodGet)
+	}
+
+	roleHandler := NewRoleHandler(stores.Roles, stores.Users)
+	subrouter.HandleFunc("/roles", helpers.MakeHandler(auth.RequirePermission(roleHandler.HandleGetAll, types.PermUsersManage))).Methods(http.MethodGet)
+	subrouter.HandleFunc("/roles/{name}/permissions", helpers.MakeHandler(auth.RequirePermission(roleHandler.HandleGrantPermission, types.PermUsersManage))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/roles/{name}/permissions/{permission}", helpers.MakeHandler(auth.RequirePermission(roleHandler.HandleRevokePermission, types.PermUsersManage))).Methods(http.MethodDelete)
+	subrouter.HandleFunc("/users", helpers.MakeHandler(auth.RequirePermission(userHandler.HandleGetAll, types.PermUsersManage))).Methods(http.MethodGet)
+	subrouter.HandleFunc("/users/{id}/unlock", helpers.MakeHandler(auth.RequirePermission(userHandler.HandleUnlock, types.PermUsersManage))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/users/{id}/suspend", helpers.MakeHandler(auth.RequirePermission(userHandler.HandleSuspend, types.PermUsersManage))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/users/{id}/unsuspend", helpers.MakeHandler(auth.RequirePermission(userHandler.HandleUnsuspend, types.PermUsersManage))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/users/{id}/role", helpers.MakeHandler(auth.RequirePermission(roleHandler.HandleUpdateUserRole, types.PermUsersManage))).Methods(http.MethodPut)
+
+	apiKeyHandler := NewAPIKeyHandler(stores.APIKeys)
+	subrouter.HandleFunc("/api-keys", helpers.MakeHandler(auth.RequirePermission(apiKeyHandler.HandleCreate, types.PermAPIKeysManage))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/api-keys", helpers.MakeHandler(auth.RequirePermission(apiKeyHandler.HandleGetAll, types.PermAPIKeysManage))).Methods(http.MethodGet)
+	subrouter.HandleFunc("/api-keys/{id}/rotate", helpers.MakeHandler(auth.RequirePermission(apiKeyHandler.HandleRotate, types.PermAPIKeysManage))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/api-keys/{id}", helpers.MakeHandler(auth.RequirePermission(apiKeyHandler.HandleRevoke, types.PermAPIKeysManage))).Methods(http.MethodDelete)
+
+	rentHandler := NewRentHandler(stores.Rent, stores.Books, stores.Users, rental)
+	subrouter.HandleFunc("/rent/book", helpers.MakeHandler(auth.AllowAPIKeys(rentHandler.HandleRentBook, types.PermLoansCheckoutForOthers))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/rent/history", helpers.MakeHandler(auth.RequirePermission(rentHandler.HandleGetAllHistory, types.PermLoansManage))).Methods(http.MethodGet)
+	subrouter.HandleFunc("/rent/return", helpers.MakeHandler(auth.AllowAPIKeys(rentHandler.HandleReturnBook, types.PermLoansManage))).Methods(http.MethodPost)
+	subrouter.HandleFunc("/rent/user-history", helpers.MakeHandler(auth.HandleAuth(rentHandler.HandleGetUserHistory))).Methods(http.MethodGet)
+
+	privacyHandler := NewPrivacyHandler(stores.Users, stores.Rent, stores.Sessions, stores.MFA, throttler)
+	subrouter.HandleFunc("/user/me/export", helpers.MakeHandler(auth.HandleAuth(privacyHandler.HandleExport))).Methods(http.MethodGet)
+	subrouter.HandleFunc("/user/me", helpers.MakeHandler(auth.HandleAuth(privacyHandler.HandleErase))).Methods(http.MethodDelete)
+	subrouter.HandleFunc("/users/{id}", helpers.MakeHandler(auth.RequirePermission(privacyHandler.HandleEraseUser, types.PermUsersManage))).Methods(http.MethodDelete)
+
+	return router
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/gorilla/mux"
+)
+
+const sessionLifetime = time.Hour * 24 * 30
+
+type SessionHandler struct {
+	store     store.SessionStore
+	userStore store.UserStore
+}
+
+func NewSessionHandler(store store.SessionStore, userStore store.UserStore) *SessionHandler {
+	return &SessionHandler{store: store, userStore: userStore}
+}
+
+// startSession records a login from this request and returns its tokens, suspended users are refused
+func startSession(r *http.Request, sessionStore store.SessionStore, user types.User) (types.LoginResponse, error) {
+	if user.SuspendedAt != nil {
+		return types.LoginResponse{}, helpers.AccountSuspended()
+	}
+
+	id := sessionStore.NewId()
+	refreshToken, refreshHash, err := helpers.GenerateRefreshToken(id)
+	if err != nil {
+		return types.LoginResponse{}, err
+	}
+
+	now := time.Now()
+	err = sessionStore.Create(r.Context(), types.Session{
+		Id:               id,
+		UserId:           user.Id,
+		UserAgent:        r.UserAgent(),
+		IP:               helpers.ClientIP(r),
+		RefreshTokenHash: refreshHash,
+		CreatedAt:        now,
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(sessionLifetime),
+	})
+	if err != nil {
+		return types.LoginResponse{}, err
+	}
+
+	token, err := helpers.CreateJWT(user.Id, user.Role, id)
+	if err != nil {
+		return types.LoginResponse{}, err
+	}
+
+	return types.LoginResponse{Token: token, RefreshToken: refreshToken}, nil
+}
+
+// HandleRefresh returns a new access token and replaces the refresh token
+func (h *SessionHandler) HandleRefresh(w http.ResponseWriter, r *http.Request) error {
+	var request types.RefreshTokenRequest
+	if err := helpers.DecodeRequest(r, &request); err != nil {
+		return err
+	}
+
+	sessionId, err := helpers.ParseRefreshToken(request.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	session, err := h.store.GetById(r.Context(), sessionId)
+	if err == sql.ErrNoRows {
+		return helpers.BadCredentials()
+	}
+	if err != nil {
+		return err
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return helpers.BadCredentials()
+	}
+
+	newToken, newHash, err := helpers.GenerateRefreshToken(sessionId)
+	if err != nil {
+		return err
+	}
+
+	rotated, err := h.store.RotateRefreshToken(r.Context(), sessionId, helpers.HashRefreshToken(request.RefreshToken), newHash)
+	if err != nil {
+		return err
+	}
+
+	// An old refresh token was used again, it may be stolen
+	if !rotated {
+		helpers.SecurityEvent(r.Context(), "refresh_token_reuse", "session_id", sessionId, "user_id", session.UserId, "ip", helpers.ClientIP(r))
+		if err := h.store.Revoke(r.Context(), sessionId); err != nil {
+			return err
+		}
+		return helpers.BadCredentials()
+	}
+
+	user, err := h.userStore.GetById(r.Context(), session.UserId)
+	if err == sql.ErrNoRows {
+		return helpers.BadCredentials()
+	}
+	if err != nil {
+		return err
+	}
+	if user.SuspendedAt != nil {
+		return helpers.AccountSuspended()
+	}
+
+	token, err := helpers.CreateJWT(user.Id, user.Role, sessionId)
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteJSON(w, http.StatusOK, types.LoginResponse{Token: token, RefreshToken: newToken})
+}
+
+func (h *SessionHandler) HandleGetAll(w http.ResponseWriter, r *http.Request) error {
+	tokenPayload, err := helpers.GetTokenPayloadFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := h.store.GetActiveByUserId(r.Context(), tokenPayload.Id)
+	if err != nil {
+		return err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == tokenPayload.SessionId
+	}
+
+	return helpers.WriteJSON(w, http.StatusOK, sessions)
+}
+
+func (h *SessionHandler) HandleDelete(w http.ResponseWriter, r *http.Request) error {
+	tokenPayload, err := helpers.GetTokenPayloadFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	return h.revoke(w, r, tokenPayload.Id, mux.Vars(r)["id"])
+}
+
+// HandleDeleteAll signs out everywhere, including the current session
+func (h *SessionHandler) HandleDeleteAll(w http.ResponseWriter, r *http.Request) error {
+	tokenPayload, err := helpers.GetTokenPayloadFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.RevokeAllByUserId(r.Context(), tokenPayload.Id); err != nil {
+		return err
+	}
+
+	return helpers.WriteOK(w)
+}
+
+func (h *SessionHandler) HandleGetUserSessions(w http.ResponseWriter, r *http.Request) error {
+	sessions, err := h.store.GetActiveByUserId(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	return helpers.WriteJSON(w, http.StatusOK, sessions)
+}
+
+func (h *SessionHandler) HandleDeleteUserSession(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	return h.revoke(w, r, vars["id"], vars["session_id"])
+}
+
+func (h *SessionHandler) HandleDeleteAllUserSessions(w http.ResponseWriter, r *http.Request) error {
+	if err := h.store.RevokeAllByUserId(r.Context(), mux.Vars(r)["id"]); err != nil {
+		return err
+	}
+
+	return helpers.WriteOK(w)
+}
+
+func (h *SessionHandler) revoke(w http.ResponseWriter, r *http.Request, userId, sessionId string) error {
+	session, err := h.store.GetById(r.Context(), sessionId)
+	if err == sql.ErrNoRows || (err == nil && session.UserId != userId) {
+		return helpers.SessionNotFound()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := h.store.Revoke(r.Context(), sessionId); err != nil {
+		return err
+	}
+
+	return helpers.WriteOK(w)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+// SetupHandler creates the initial admin through the API using a one-time token.
+// The token only lives in memory and is discarded after the first successful use.
+type SetupHandler struct {
+	userStore store.UserStore
+	mu        sync.Mutex
+	token     string
+}
+
+func NewSetupHandler(userStore store.UserStore) *SetupHandler {
+	return &SetupHandler{userStore: userStore}
+}
+
+// GenerateToken creates a new setup token if there is no admin yet.
+// It returns an empty string when setup is not needed.
+func (h *SetupHandler) GenerateToken(ctx context.Context) (string, error) {
+	hasAdmin, err := h.userStore.HasRole(ctx, types.RoleAdmin)
+	if err != nil {
+		return "", err
+	}
+
+	if hasAdmin {
+		return "", nil
+	}
+
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.token = hex.EncodeToString(bytes)
+
+	return h.token, nil
+}
+
+func (h *SetupHandler) HandleCreateAdmin(w http.ResponseWriter, r *http.Request) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	given := r.Header.Get("X-Setup-Token")
+	if h.token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(h.token)) != 1 {
+		return helpers.BadCredentials()
+	}
+
+	var user types.RegisterUserRequest
+	if err := helpers.DecodeRequest(r, &user); err != nil {
+		return err
+	}
+
+	if err := helpers.CheckPasswordPolicy(user.Password); err != nil {
+		return err
+	}
+
+	available, err := h.userStore.IsUsernameAvailable(r.Context(), user.Username)
+	if err != nil {
+		return err
+	}
+
+	if !available {
+		return helpers.UsernameTaken()
+	}
+
+	hashed, err := helpers.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	err = h.userStore.Insert(r.Context(), user.Username, hashed, user.FirstName, user.LastName, types.RoleAdmin)
+	if err == store.ErrUsernameTaken {
+		return helpers.UsernameTaken()
+	}
+	if err != nil {
+		return err
+	}
+
+	// One-time token
+	h.token = ""
+
+	return helpers.WriteOK(w)
+}
@@ -1,39 +1,47 @@
 package api
 
 import (
-	"encoding/json"
+	"database/sql"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/burakiscoding/go-book-rent/helpers"
 	"github.com/burakiscoding/go-book-rent/store"
 	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/gorilla/mux"
 )
 
 type UserHandler struct {
-	store store.UserStore
+	store           store.UserStore
+	mfaStore        store.MFAStore
+	sessionStore    store.SessionStore
+	throttler       *LoginThrottler
+	requireAdminMFA bool
 }
 
-func NewUserHandler(store store.UserStore) *UserHandler {
-	return &UserHandler{store: store}
+func NewUserHandler(store store.UserStore, mfaStore store.MFAStore, sessionStore store.SessionStore, throttler *LoginThrottler, requireAdminMFA bool) *UserHandler {
+	return &UserHandler{store: store, mfaStore: mfaStore, sessionStore: sessionStore, throttler: throttler, requireAdminMFA: requireAdminMFA}
 }
 
 func (h *UserHandler) HandleRegister(w http.ResponseWriter, r *http.Request) error {
 	var user types.RegisterUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		return helpers.InvalidJSON()
+	if err := helpers.DecodeRequest(r, &user); err != nil {
+		return err
 	}
 
-	if user.Username == "" || user.Password == "" || user.FirstName == "" || user.LastName == "" {
-		return helpers.InvalidRequestData()
+	if err := helpers.CheckPasswordPolicy(user.Password); err != nil {
+		return err
 	}
 
-	available, err := h.store.IsUsernameAvailable(user.Username)
+	available, err := h.store.IsUsernameAvailable(r.Context(), user.Username)
 	if err != nil {
 		return err
 	}
 
 	if !available {
-		return helpers.NewAPIError(http.StatusBadRequest, "username is already taken")
+		return helpers.UsernameTaken()
 	}
 
 	hashed, err := helpers.HashPassword(user.Password)
@@ -41,7 +49,11 @@ func (h *UserHandler) HandleRegister(w http.ResponseWriter, r *http.Request) err
 		return err
 	}
 
-	if err := h.store.Insert(user.Username, hashed, user.FirstName, user.LastName, types.RoleUser); err != nil {
+	err = h.store.Insert(r.Context(), user.Username, hashed, user.FirstName, user.LastName, types.RoleUser)
+	if err == store.ErrUsernameTaken {
+		return helpers.UsernameTaken()
+	}
+	if err != nil {
 		return err
 	}
 
@@ -50,30 +62,81 @@ func (h *UserHandler) HandleRegister(w http.ResponseWriter, r *http.Request) err
 
 func (h *UserHandler) HandleLogin(w http.ResponseWriter, r *http.Request) error {
 	var user types.LoginUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		return helpers.InvalidJSON()
+	if err := helpers.DecodeRequest(r, &user); err != nil {
+		return err
+	}
+
+	ip, now := helpers.ClientIP(r), time.Now()
+	wait, err := h.throttler.Attempt(r.Context(), user.Username, ip, now)
+	if err != nil {
+		return err
 	}
 
-	if user.Username == "" || user.Password == "" {
-		return helpers.InvalidRequestData()
+	if wait > 0 {
+		return retryAfter(w, wait)
 	}
 
-	foundUser, err := h.store.GetByUsername(user.Username)
-	if err != nil {
+	foundUser, err := h.store.GetByUsername(r.Context(), user.Username)
+	if err == sql.ErrNoRows {
 		return helpers.BadCredentials()
 	}
+	if err != nil {
+		return err
+	}
 
 	isPasswordCorrect := helpers.CheckHashedPassword(foundUser.Password, user.Password)
 	if !isPasswordCorrect {
 		return helpers.BadCredentials()
 	}
 
-	token, err := helpers.CreateJWT(foundUser.Id, foundUser.Role)
+	if err := h.throttler.Success(r.Context(), user.Username, ip, now); err != nil {
+		return err
+	}
+
+	// Upgrade hashes made with old settings while we have the plain password
+	// The login goes on if it fails, the old hash still works
+	if helpers.PasswordNeedsRehash(foundUser.Password) {
+		hashed, err := helpers.HashPassword(user.Password)
+		if err == nil {
+			err = h.store.UpdatePassword(r.Context(), foundUser.Id, hashed)
+		}
+		if err != nil {
+			helpers.Logger(r.Context()).Warn("password rehash failed", "err", err.Error(), "user_id", foundUser.Id)
+		}
+	}
+
+	return finishLogin(w, r, h.mfaStore, h.sessionStore, h.requireAdminMFA, foundUser)
+}
+
+// finishLogin starts a session for a user whose first factor was checked, or returns an MFA
+// challenge when the user has MFA or is an admin who must enroll. Every way of logging in ends here.
+func finishLogin(w http.ResponseWriter, r *http.Request, mfaStore store.MFAStore, sessionStore store.SessionStore, requireAdminMFA bool, user types.User) error {
+	mfaEnabled, err := mfaStore.IsEnabled(r.Context(), user.Id)
+	if err != nil {
+		return err
+	}
+
+	// Second step is required, see MFAHandler.HandleLoginVerify
+	enrollmentRequired := !mfaEnabled && requireAdminMFA && user.Role == types.RoleAdmin
+	if mfaEnabled || enrollmentRequired {
+		mfaToken, err := helpers.CreateMFAToken(user.Id)
+		if err != nil {
+			return err
+		}
+
+		return helpers.WriteJSON(w, http.StatusOK, types.MFAChallengeResponse{
+			MFARequired:        true,
+			EnrollmentRequired: enrollmentRequired,
+			MFAToken:           mfaToken,
+		})
+	}
+
+	response, err := startSession(r, sessionStore, user)
 	if err != nil {
 		return err
 	}
 
-	return helpers.WriteJSON(w, http.StatusOK, map[string]string{"token": token})
+	return helpers.WriteJSON(w, http.StatusOK, response)
 }
 
 func (h *UserHandler) HandleGetDetails(w http.ResponseWriter, r *http.Request) error {
@@ -82,7 +145,7 @@ func (h *UserHandler) HandleGetDetails(w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 
-	user, err := h.store.GetById(tokenPayload.Id)
+	user, err := h.store.GetById(r.Context(), tokenPayload.Id)
 	if err != nil {
 		return err
 	}
@@ -90,33 +153,80 @@ func (h *UserHandler) HandleGetDetails(w http.ResponseWriter, r *http.Request) e
 	return helpers.WriteJSON(w, http.StatusOK, user)
 }
 
-func (h *UserHandler) HandleAdminRegister(w http.ResponseWriter, r *http.Request) error {
-	var user types.RegisterUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		return helpers.InvalidJSON()
+func (h *UserHandler) HandleUnlock(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.store.GetById(r.Context(), mux.Vars(r)["id"])
+	if err == sql.ErrNoRows {
+		return helpers.UserNotFound()
+	}
+	if err != nil {
+		return err
 	}
 
-	if user.Username == "" || user.Password == "" || user.FirstName == "" || user.LastName == "" {
-		return helpers.InvalidRequestData()
+	if err := h.throttler.Unlock(r.Context(), user.Username); err != nil {
+		return err
 	}
 
-	available, err := h.store.IsUsernameAvailable(user.Username)
+	return helpers.WriteOK(w)
+}
+
+// HandleGetAll lists the users for admins
+func (h *UserHandler) HandleGetAll(w http.ResponseWriter, r *http.Request) error {
+	users, err := h.store.GetAll(r.Context())
 	if err != nil {
 		return err
 	}
 
-	if !available {
-		return helpers.NewAPIError(http.StatusBadRequest, "username is already taken")
+	return helpers.WriteJSON(w, http.StatusOK, users)
+}
+
+// HandleSuspend blocks a user from logging in and signs out their sessions.
+// Their API keys stop working too, until the user is reinstated.
+func (h *UserHandler) HandleSuspend(w http.ResponseWriter, r *http.Request) error {
+	return h.setSuspended(w, r, true)
+}
+
+// HandleUnsuspend reinstates a suspended user, they have to log in again
+func (h *UserHandler) HandleUnsuspend(w http.ResponseWriter, r *http.Request) error {
+	return h.setSuspended(w, r, false)
+}
+
+func (h *UserHandler) setSuspended(w http.ResponseWriter, r *http.Request, suspended bool) error {
+	tokenPayload, err := helpers.GetTokenPayloadFromContext(r)
+	if err != nil {
+		return err
 	}
 
-	hashed, err := helpers.HashPassword(user.Password)
+	user, err := h.store.GetById(r.Context(), mux.Vars(r)["id"])
+	if err == sql.ErrNoRows {
+		return helpers.UserNotFound()
+	}
 	if err != nil {
 		return err
 	}
 
-	if err := h.store.Insert(user.Username, hashed, user.FirstName, user.LastName, types.RoleAdmin); err != nil {
+	// An admin locking themselves out could leave nobody to undo it
+	if user.Id == tokenPayload.Id {
+		return helpers.NewAPIError(helpers.CodeCannotSuspendSelf, "you can't suspend yourself")
+	}
+
+	if err := h.store.SetSuspended(r.Context(), user.Id, suspended); err != nil {
 		return err
 	}
 
+	event := "user_unsuspended"
+	if suspended {
+		event = "user_suspended"
+		if err := h.sessionStore.RevokeAllByUserId(r.Context(), user.Id); err != nil {
+			return err
+		}
+	}
+	helpers.SecurityEvent(r.Context(), event, "user_id", user.Id, "by", tokenPayload.Id)
+
 	return helpers.WriteOK(w)
 }
+
+func retryAfter(w http.ResponseWriter, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	return helpers.TooManyAttempts()
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+// RunAdmin handles "book-rent admin <command>"
+func RunAdmin(args []string, userStore store.UserStore) error {
+	if len(args) == 0 {
+		return errors.New("usage: book-rent admin create -username <username> -first-name <name> -last-name <name>")
+	}
+
+	switch args[0] {
+	case "create":
+		return createAdmin(args[1:], userStore, os.Stdin)
+	default:
+		return fmt.Errorf("unknown admin command: %s", args[0])
+	}
+}
+
+func createAdmin(args []string, userStore store.UserStore, stdin io.Reader) error {
+	fs := flag.NewFlagSet("admin create", flag.ContinueOnError)
+	username := fs.String("username", "", "admin username")
+	firstName := fs.String("first-name", "", "admin first name")
+	lastName := fs.String("last-name", "", "admin last name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *username == "" || *firstName == "" || *lastName == "" {
+		return errors.New("username, first-name and last-name are required")
+	}
+
+	// Password is never accepted as a flag so it doesn't end up in shell history
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if err := helpers.CheckPasswordPolicy(password); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	available, err := userStore.IsUsernameAvailable(ctx, *username)
+	if err != nil {
+		return err
+	}
+
+	if !available {
+		return errors.New("username is already taken")
+	}
+
+	hashed, err := helpers.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = userStore.Insert(ctx, *username, hashed, *firstName, *lastName, types.RoleAdmin)
+	if err == store.ErrUsernameTaken {
+		return errors.New("username is already taken")
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "admin %s created\n", *username)
+	return nil
+}
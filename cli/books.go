@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+const booksUsage = `usage: book-rent books <command>
+  list   [-output table|json|csv]
+  add    -name <name> [-quantity <n>]
+  stock  -id <id> -quantity <n>
+  import -file <file.csv|->
+Every command takes -api-url to go through the API instead of the database.`
+
+func runBooks(args []string, openStores OpenStores) error {
+	if len(args) == 0 {
+		return errors.New(booksUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		return listBooks(args[1:], openStores)
+	case "add":
+		return addBook(args[1:], openStores)
+	case "stock":
+		return addStock(args[1:], openStores)
+	case "import":
+		return importBooks(args[1:], openStores)
+	default:
+		return fmt.Errorf("unknown books command: %s\n%s", args[0], booksUsage)
+	}
+}
+
+func listBooks(args []string, openStores OpenStores) error {
+	fs, o := newOpsFlagSet("books list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	b, err := o.backend(openStores)
+	if err != nil {
+		return err
+	}
+
+	books, err := b.ListBooks(context.Background())
+	if err != nil {
+		return err
+	}
+	if books == nil {
+		books = []types.Book{}
+	}
+
+	rows := make([][]string, len(books))
+	for i, book := range books {
+		rows[i] = []string{strconv.Itoa(book.Id), book.Name, strconv.Itoa(book.Quantity), book.CreatedAt.UTC().Format(time.RFC3339)}
+	}
+	return writeList(os.Stdout, o.output, books, []string{"id", "name", "quantity", "created_at"}, rows)
+}
+
+func addBook(args []string, openStores OpenStores) error {
+	fs, o := newOpsFlagSet("books add")
+	name := fs.String("name", "", "book name")
+	quantity := fs.Int("quantity", 0, "copies in stock")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	b, err := o.backend(openStores)
+	if err != nil {
+		return err
+	}
+
+	if err := b.AddBook(context.Background(), *name, *quantity); err != nil {
+		return err
+	}
+
+	fmt.Printf("added %s with %d copies\n", *name, *quantity)
+	return nil
+}
+
+func addStock(args []string, openStores OpenStores) error {
+	fs, o := newOpsFlagSet("books stock")
+	id := fs.Int("id", 0, "book id")
+	quantity := fs.Int("quantity", 0, "copies to add")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *id <= 0 {
+		return errors.New("id is required")
+	}
+
+	b, err := o.backend(openStores)
+	if err != nil {
+		return err
+	}
+
+	if err := b.AddStock(context.Background(), *id, *quantity); err != nil {
+		return err
+	}
+
+	fmt.Printf("added %d copies to book %d\n", *quantity, *id)
+	return nil
+}
+
+// importBooks adds the books of a CSV file with a name and an optional quantity column.
+// The whole file is checked before the first book is added.
+func importBooks(args []string, openStores OpenStores) error {
+	fs, o := newOpsFlagSet("books import")
+	file := fs.String("file", "", "CSV file with a header row, - reads stdin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *file == "" {
+		return errors.New("file is required")
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	books, err := readBooksCSV(r)
+	if err != nil {
+		return err
+	}
+
+	b, err := o.backend(openStores)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for i, book := range books {
+		if err := b.AddBook(ctx, book.Name, book.Quantity); err != nil {
+			return fmt.Errorf("imported %d of %d books, %s failed: %w", i, len(books), book.Name, err)
+		}
+	}
+
+	fmt.Printf("imported %d books\n", len(books))
+	return nil
+}
+
+func readBooksCSV(r io.Reader) ([]types.AddBookRequest, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nameColumn, quantityColumn := -1, -1
+	for i, column := range header {
+		switch strings.ToLower(strings.TrimSpace(column)) {
+		case "name":
+			nameColumn = i
+		case "quantity":
+			quantityColumn = i
+		}
+	}
+	if nameColumn == -1 {
+		return nil, errors.New("header has no name column")
+	}
+
+	var books []types.AddBookRequest
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		book := types.AddBookRequest{Name: strings.TrimSpace(record[nameColumn])}
+		if quantityColumn != -1 && strings.TrimSpace(record[quantityColumn]) != "" {
+			book.Quantity, err = strconv.Atoi(strings.TrimSpace(record[quantityColumn]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid quantity %q", line, record[quantityColumn])
+			}
+		}
+		// The same rules as the API
+		if err := validate(book); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		books = append(books, book)
+	}
+
+	return books, nil
+}
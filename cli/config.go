@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/burakiscoding/go-book-rent/config"
+)
+
+// RunConfig handles "book-rent config <command>"
+func RunConfig(args []string, cfg config.Config) error {
+	if len(args) == 0 {
+		return errors.New("usage: book-rent config print")
+	}
+
+	switch args[0] {
+	case "print":
+		if err := cfg.Print(os.Stdout); err != nil {
+			return err
+		}
+		// Printing works on an invalid config too, so it can be used to find the problem
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid config:\n%w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown config command: %s", args[0])
+	}
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RunKeys handles "book-rent keys <command>"
+func RunKeys(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: book-rent keys generate -dir <dir> [-alg EdDSA|RS256] [-kid <id>]")
+	}
+
+	switch args[0] {
+	case "generate":
+		return generateKey(args[1:])
+	default:
+		return fmt.Errorf("unknown keys command: %s", args[0])
+	}
+}
+
+func generateKey(args []string) error {
+	fs := flag.NewFlagSet("keys generate", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory of JWT_KEYS_DIR")
+	alg := fs.String("alg", "EdDSA", "EdDSA or RS256")
+	kid := fs.String("kid", time.Now().UTC().Format("20060102150405"), "key id, the file name without .pem")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *dir == "" {
+		return errors.New("dir is required")
+	}
+
+	var key crypto.PrivateKey
+	var err error
+	switch *alg {
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return fmt.Errorf("unsupported algorithm: %s", *alg)
+	}
+	if err != nil {
+		return err
+	}
+
+	bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(*dir, *kid+".pem")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: bytes}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "key %s written to %s\n", *kid, path)
+	return nil
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+const loansUsage = `usage: book-rent loans <command>
+  list    [-open] [-overdue] [-user <id|username>] [-output table|json|csv]
+  checkin -id <loan id>
+Every command takes -api-url to go through the API instead of the database.`
+
+// Loan states shown by loans list
+const (
+	loanOpen     = "open"
+	loanOverdue  = "overdue"
+	loanReturned = "returned"
+)
+
+func runLoans(args []string, openStores OpenStores) error {
+	if len(args) == 0 {
+		return errors.New(loansUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		return listLoans(args[1:], openStores)
+	case "checkin":
+		return checkIn(args[1:], openStores)
+	default:
+		return fmt.Errorf("unknown loans command: %s\n%s", args[0], loansUsage)
+	}
+}
+
+// loan is a rent history with its due date and state
+type loan struct {
+	types.RentHistory
+	DueTime time.Time `json:"due_time"`
+	Status  string    `json:"status"`
+}
+
+func newLoan(h types.RentHistory, now time.Time) loan {
+	l := loan{RentHistory: h, DueTime: h.RentStartTime.AddDate(0, 0, h.RentDurationInDays), Status: loanOpen}
+	if h.RentReturnTime != nil {
+		l.Status = loanReturned
+	} else if now.After(l.DueTime) {
+		l.Status = loanOverdue
+	}
+	return l
+}
+
+func listLoans(args []string, openStores OpenStores) error {
+	fs, o := newOpsFlagSet("loans list")
+	open := fs.Bool("open", false, "only books that are not returned, overdue ones included")
+	overdue := fs.Bool("overdue", false, "only books past their due date")
+	user := fs.String("user", "", "only loans of this user id or username")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	b, err := o.backend(openStores)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	userId := ""
+	if *user != "" {
+		found, err := findUser(ctx, b, *user)
+		if err != nil {
+			return err
+		}
+		userId = found.Id
+	}
+
+	history, err := b.ListLoans(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	loans := []loan{}
+	for _, h := range history {
+		l := newLoan(h, now)
+		if (*open && l.Status == loanReturned) || (*overdue && l.Status != loanOverdue) || (userId != "" && l.UserId != userId) {
+			continue
+		}
+		loans = append(loans, l)
+	}
+
+	rows := make([][]string, len(loans))
+	for i, l := range loans {
+		rows[i] = []string{l.Id, strconv.Itoa(l.BookId), l.UserId, formatTime(&l.RentStartTime), formatTime(&l.DueTime), formatTime(l.RentReturnTime), l.Status}
+	}
+	return writeList(os.Stdout, o.output, loans, []string{"id", "book_id", "user_id", "rent_start_time", "due_time", "rent_return_time", "status"}, rows)
+}
+
+func checkIn(args []string, openStores OpenStores) error {
+	fs, o := newOpsFlagSet("loans checkin")
+	id := fs.String("id", "", "loan id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *id == "" {
+		return errors.New("id is required")
+	}
+
+	b, err := o.backend(openStores)
+	if err != nil {
+		return err
+	}
+
+	if err := b.CheckIn(context.Background(), *id); err != nil {
+		return err
+	}
+
+	fmt.Printf("checked in loan %s\n", *id)
+	return nil
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/burakiscoding/go-book-rent/api"
+	"github.com/burakiscoding/go-book-rent/oidc"
+	"github.com/burakiscoding/go-book-rent/store"
+)
+
+// RunOpenAPI handles "book-rent openapi <command>"
+func RunOpenAPI(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: book-rent openapi check|print")
+	}
+
+	switch args[0] {
+	case "check":
+		return checkOpenAPI()
+	case "print":
+		spec, err := api.OpenAPISpec()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(os.Stdout, string(spec))
+		return err
+	default:
+		return fmt.Errorf("unknown openapi command: %s", args[0])
+	}
+}
+
+// checkOpenAPI builds a router with every optional route enabled and compares it with the spec
+func checkOpenAPI() error {
+	stores := store.NewMemoryStores()
+	router := api.NewRouter(stores, api.RouterConfig{
+		SetupHandler: api.NewSetupHandler(stores.Users),
+		OIDCProvider: &oidc.Provider{},
+	})
+
+	errs := api.CheckOpenAPI(router)
+	if len(errs) == 0 {
+		fmt.Println("spec matches the routes and types")
+		return nil
+	}
+
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = "  " + err.Error()
+	}
+	return fmt.Errorf("spec drifted from the code:\n%s", strings.Join(lines, "\n"))
+}
@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/burakiscoding/go-book-rent/client"
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/google/uuid"
+)
+
+// Environment variables of the API mode. The key is never accepted as a flag so it doesn't end up in shell history.
+const (
+	envAPIURL = "BOOK_RENT_API_URL"
+	envAPIKey = "BOOK_RENT_API_KEY"
+)
+
+// OpenStores connects to the configured database, it is only called when a command doesn't use the API
+type OpenStores func() (store.Stores, error)
+
+// RunOps handles "book-rent books|users|loans <command>"
+func RunOps(args []string, openStores OpenStores) error {
+	switch args[0] {
+	case "books":
+		return runBooks(args[1:], openStores)
+	case "users":
+		return runUsers(args[1:], openStores)
+	case "loans":
+		return runLoans(args[1:], openStores)
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// IsOpsCommand reports whether RunOps handles the command
+func IsOpsCommand(name string) bool {
+	return name == "books" || name == "users" || name == "loans"
+}
+
+// backend runs the commands on the stores directly or through the HTTP API.
+// Both apply the same checks as the API handlers.
+type backend interface {
+	ListBooks(ctx context.Context) ([]types.Book, error)
+	AddBook(ctx context.Context, name string, quantity int) error
+	AddStock(ctx context.Context, id, quantity int) error
+	ListUsers(ctx context.Context) ([]types.User, error)
+	SetSuspended(ctx context.Context, id string, suspended bool) error
+	SetRole(ctx context.Context, id, role string) error
+	ListLoans(ctx context.Context) ([]types.RentHistory, error)
+	CheckIn(ctx context.Context, id string) error
+}
+
+// opsFlags are shared by every subcommand
+type opsFlags struct {
+	apiURL string
+	output string
+}
+
+func newOpsFlagSet(name string) (*flag.FlagSet, *opsFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	o := &opsFlags{}
+	fs.StringVar(&o.apiURL, "api-url", os.Getenv(envAPIURL), "use the HTTP API at this address instead of the database, the API key is read from "+envAPIKey)
+	fs.StringVar(&o.output, "output", outputTable, "table, json or csv")
+	return fs, o
+}
+
+func (o *opsFlags) backend(openStores OpenStores) (backend, error) {
+	if err := checkOutput(o.output); err != nil {
+		return nil, err
+	}
+
+	if o.apiURL != "" {
+		key := os.Getenv(envAPIKey)
+		if key == "" {
+			return nil, fmt.Errorf("%s is required with -api-url", envAPIKey)
+		}
+		return &apiBackend{client: client.New(client.Config{BaseURL: o.apiURL, APIKey: key})}, nil
+	}
+
+	stores, err := openStores()
+	if err != nil {
+		return nil, err
+	}
+	return &storeBackend{stores: stores}, nil
+}
+
+// findUser accepts a user id or a username
+func findUser(ctx context.Context, b backend, user string) (types.User, error) {
+	users, err := b.ListUsers(ctx)
+	if err != nil {
+		return types.User{}, err
+	}
+
+	_, idErr := uuid.Parse(user)
+	for _, u := range users {
+		if (idErr == nil && u.Id == user) || u.Username == user {
+			return u, nil
+		}
+	}
+
+	return types.User{}, fmt.Errorf("user not found: %s", user)
+}
+
+// validate applies the rules of the API, the error reads without the HTTP status
+func validate(v any) error {
+	err := helpers.Validate(v)
+	var apiErr helpers.APIError
+	if errors.As(err, &apiErr) {
+		return errors.New(apiErr.Detail())
+	}
+	return err
+}
+
+type storeBackend struct {
+	stores store.Stores
+}
+
+func (b *storeBackend) ListBooks(ctx context.Context) ([]types.Book, error) {
+	return b.stores.Books.GetAll(ctx)
+}
+
+func (b *storeBackend) AddBook(ctx context.Context, name string, quantity int) error {
+	if err := validate(types.AddBookRequest{Name: name, Quantity: quantity}); err != nil {
+		return err
+	}
+	return b.stores.Books.Insert(ctx, name, quantity)
+}
+
+func (b *storeBackend) AddStock(ctx context.Context, id, quantity int) error {
+	if err := validate(types.AddStockRequest{Quantity: quantity}); err != nil {
+		return err
+	}
+
+	err := b.stores.Books.AddStock(ctx, id, quantity)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("book not found: %d", id)
+	}
+	return err
+}
+
+func (b *storeBackend) ListUsers(ctx context.Context) ([]types.User, error) {
+	return b.stores.Users.GetAll(ctx)
+}
+
+// SetSuspended signs out the sessions of suspended users, like the API
+func (b *storeBackend) SetSuspended(ctx context.Context, id string, suspended bool) error {
+	if err := b.stores.Users.SetSuspended(ctx, id, suspended); err != nil {
+		return err
+	}
+
+	if !suspended {
+		return nil
+	}
+	return b.stores.Sessions.RevokeAllByUserId(ctx, id)
+}
+
+func (b *storeBackend) SetRole(ctx context.Context, id, role string) error {
+	exists, err := b.stores.Roles.Exists(ctx, role)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("unknown role: %s", role)
+	}
+
+	return b.stores.Users.UpdateRole(ctx, id, role)
+}
+
+func (b *storeBackend) ListLoans(ctx context.Context) ([]types.RentHistory, error) {
+	return b.stores.Rent.GetAllHistory(ctx)
+}
+
+func (b *storeBackend) CheckIn(ctx context.Context, id string) error {
+	err := b.stores.Rent.ReturnBook(ctx, id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("loan not found: %s", id)
+	}
+	return err
+}
+
+type apiBackend struct {
+	client *client.Client
+}
+
+func (b *apiBackend) ListBooks(ctx context.Context) ([]types.Book, error) {
+	return b.client.ListBooks(ctx)
+}
+
+func (b *apiBackend) AddBook(ctx context.Context, name string, quantity int) error {
+	return b.client.CreateBook(ctx, types.AddBookRequest{Name: name, Quantity: quantity})
+}
+
+func (b *apiBackend) AddStock(ctx context.Context, id, quantity int) error {
+	return b.client.AddStock(ctx, id, quantity)
+}
+
+func (b *apiBackend) ListUsers(ctx context.Context) ([]types.User, error) {
+	return b.client.ListUsers(ctx)
+}
+
+func (b *apiBackend) SetSuspended(ctx context.Context, id string, suspended bool) error {
+	if suspended {
+		return b.client.SuspendUser(ctx, id)
+	}
+	return b.client.UnsuspendUser(ctx, id)
+}
+
+func (b *apiBackend) SetRole(ctx context.Context, id, role string) error {
+	return b.client.SetUserRole(ctx, id, role)
+}
+
+func (b *apiBackend) ListLoans(ctx context.Context) ([]types.RentHistory, error) {
+	return b.client.RentHistory(ctx)
+}
+
+func (b *apiBackend) CheckIn(ctx context.Context, id string) error {
+	return b.client.ReturnBook(ctx, id)
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+const usersUsage = `usage: book-rent users <command>
+  list      [-suspended] [-output table|json|csv]
+  suspend   -user <id|username>
+  unsuspend -user <id|username>
+  set-role  -user <id|username> -role <role>
+Every command takes -api-url to go through the API instead of the database.`
+
+func runUsers(args []string, openStores OpenStores) error {
+	if len(args) == 0 {
+		return errors.New(usersUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		return listUsers(args[1:], openStores)
+	case "suspend":
+		return suspendUser(args[1:], openStores, true)
+	case "unsuspend":
+		return suspendUser(args[1:], openStores, false)
+	case "set-role":
+		return setUserRole(args[1:], openStores)
+	default:
+		return fmt.Errorf("unknown users command: %s\n%s", args[0], usersUsage)
+	}
+}
+
+func listUsers(args []string, openStores OpenStores) error {
+	fs, o := newOpsFlagSet("users list")
+	suspendedOnly := fs.Bool("suspended", false, "only suspended users")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	b, err := o.backend(openStores)
+	if err != nil {
+		return err
+	}
+
+	all, err := b.ListUsers(context.Background())
+	if err != nil {
+		return err
+	}
+
+	users := []types.User{}
+	for _, u := range all {
+		if !*suspendedOnly || u.SuspendedAt != nil {
+			u.Password = ""
+			users = append(users, u)
+		}
+	}
+
+	rows := make([][]string, len(users))
+	for i, u := range users {
+		rows[i] = []string{u.Id, u.Username, u.FirstName, u.LastName, u.Role, u.CreatedAt.UTC().Format(time.RFC3339), formatTime(u.SuspendedAt)}
+	}
+	return writeList(os.Stdout, o.output, users, []string{"id", "username", "first_name", "last_name", "role", "created_at", "suspended_at"}, rows)
+}
+
+func suspendUser(args []string, openStores OpenStores, suspended bool) error {
+	name := "users unsuspend"
+	if suspended {
+		name = "users suspend"
+	}
+	fs, o := newOpsFlagSet(name)
+	user := fs.String("user", "", "user id or username")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *user == "" {
+		return errors.New("user is required")
+	}
+
+	b, err := o.backend(openStores)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	found, err := findUser(ctx, b, *user)
+	if err != nil {
+		return err
+	}
+
+	if err := b.SetSuspended(ctx, found.Id, suspended); err != nil {
+		return err
+	}
+
+	if suspended {
+		fmt.Printf("suspended %s, their sessions are signed out\n", found.Username)
+	} else {
+		fmt.Printf("reinstated %s\n", found.Username)
+	}
+	return nil
+}
+
+func setUserRole(args []string, openStores OpenStores) error {
+	fs, o := newOpsFlagSet("users set-role")
+	user := fs.String("user", "", "user id or username")
+	role := fs.String("role", "", "new role, e.g. user, librarian or admin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *user == "" || *role == "" {
+		return errors.New("user and role are required")
+	}
+
+	b, err := o.backend(openStores)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	found, err := findUser(ctx, b, *user)
+	if err != nil {
+		return err
+	}
+
+	if err := b.SetRole(ctx, found.Id, *role); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is now %s\n", found.Username, *role)
+	return nil
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+func (c *Client) ListBooks(ctx context.Context) ([]types.Book, error) {
+	var books []types.Book
+	err := c.do(ctx, http.MethodGet, "/books", nil, &books)
+	return books, err
+}
+
+func (c *Client) GetBook(ctx context.Context, id int) (types.Book, error) {
+	var book types.Book
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/books/%d", id), nil, &book)
+	return book, err
+}
+
+// CreateBook needs the books:write permission
+func (c *Client) CreateBook(ctx context.Context, book types.AddBookRequest) error {
+	return c.do(ctx, http.MethodPost, "/books", book, nil)
+}
+
+// AddStock adds copies of a book, it needs the books:write permission
+func (c *Client) AddStock(ctx context.Context, id, quantity int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/books/%d/stock", id), types.AddStockRequest{Quantity: quantity}, nil)
+}
+
+// UpdateBook needs the books:write permission
+func (c *Client) UpdateBook(ctx context.Context, id int, name string) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/books/%d", id), types.UpdateBookRequest{Name: name}, nil)
+}
+
+// DeleteBook needs the books:write permission
+func (c *Client) DeleteBook(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/books/%d", id), nil, nil)
+}
@@ -0,0 +1,235 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiPrefix = "/api/v1"
+
+// Longer Retry-After waits, like a login lockout, are returned to the caller instead
+const maxRetryWait = time.Second * 10
+
+type Config struct {
+	// Address of the server, e.g. https://books.example.com
+	BaseURL string
+	// Optional, nil uses http.DefaultTransport. Wrap it to add tracing, logging or a test double.
+	Transport http.RoundTripper
+	// Per attempt, zero uses 30 seconds
+	Timeout time.Duration
+	// Sent as X-API-Key when there is no token from a login
+	APIKey string
+	// Retries of idempotent requests (GET, PUT, DELETE) after network errors,
+	// 429, 502, 503 and 504. Zero uses 2, negative disables retries.
+	MaxRetries int
+	// First wait between retries, doubled on each retry. Zero uses 200ms.
+	RetryBackoff time.Duration
+}
+
+// Client calls the book rent API. It is safe for concurrent use.
+// After Login it sends the access token and refreshes it once it expires.
+type Client struct {
+	baseURL      string
+	http         *http.Client
+	apiKey       string
+	maxRetries   int
+	retryBackoff time.Duration
+
+	mu           sync.Mutex
+	token        string
+	refreshToken string
+	// Held while refreshing, a refresh token works only once
+	refreshMu sync.Mutex
+}
+
+func New(config Config) *Client {
+	if config.Timeout == 0 {
+		config.Timeout = time.Second * 30
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 2
+	} else if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = time.Millisecond * 200
+	}
+
+	return &Client{
+		baseURL:      strings.TrimSuffix(config.BaseURL, "/"),
+		http:         &http.Client{Transport: config.Transport, Timeout: config.Timeout},
+		apiKey:       config.APIKey,
+		maxRetries:   config.MaxRetries,
+		retryBackoff: config.RetryBackoff,
+	}
+}
+
+// Tokens returns the current access and refresh token, e.g. to store them between runs
+func (c *Client) Tokens() (token, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, c.refreshToken
+}
+
+// SetTokens makes the client use tokens from an earlier login
+func (c *Client) SetTokens(token, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token, c.refreshToken = token, refreshToken
+}
+
+// do sends a request to path under /api/v1. A non-nil body is sent as JSON and a
+// non-nil out receives the JSON response. When the access token was rejected it is
+// refreshed once and the request sent again.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	payload, err := marshal(body)
+	if err != nil {
+		return err
+	}
+
+	token, _ := c.Tokens()
+	err = c.send(ctx, method, path, payload, token, out)
+	if !errors.Is(err, ErrUnauthorized) || token == "" {
+		return err
+	}
+
+	refreshed, refreshErr := c.refresh(ctx, token)
+	if refreshErr != nil {
+		if errors.Is(refreshErr, errNoRefreshToken) {
+			return err
+		}
+		return refreshErr
+	}
+	return c.send(ctx, method, path, payload, refreshed, out)
+}
+
+// doPublic sends a request without the access token, for the login and refresh calls
+func (c *Client) doPublic(ctx context.Context, method, path string, body, out any) error {
+	payload, err := marshal(body)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, method, path, payload, "", out)
+}
+
+func marshal(body any) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	return json.Marshal(body)
+}
+
+// send runs one request with retries
+func (c *Client) send(ctx context.Context, method, path string, payload []byte, token string, out any) error {
+	retries := 0
+	if idempotent(method) {
+		retries = c.maxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		wait, err := c.attempt(ctx, method, path, payload, token, out)
+		if err == nil || attempt >= retries || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		if wait > maxRetryWait {
+			return err
+		}
+		if wait == 0 {
+			wait = c.retryBackoff << attempt
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends the request once. The duration is the Retry-After of the response, if any.
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, token string, out any) (time.Duration, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+apiPrefix+path, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, &transportError{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return retryAfter(resp), decodeError(resp)
+	}
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return 0, nil
+	}
+	return 0, json.NewDecoder(resp.Body).Decode(out)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryable(err error) bool {
+	// Includes the per attempt timeout, send doesn't retry once ctx is done
+	var transportErr *transportError
+	if errors.As(err, &transportErr) {
+		return true
+	}
+
+	return errors.Is(err, ErrTooManyRequests) || errors.Is(err, ErrUnavailable)
+}
+
+// retryAfter reads the Retry-After header in seconds, the API doesn't send dates
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// transportError marks failures before a response arrived, they are retried
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,269 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/api"
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+const testPassword = "Correct-Horse-9"
+
+func TestMain(m *testing.M) {
+	keys, err := helpers.LoadKeyManager("0123456789abcdef0123456789abcdef", "", "")
+	if err != nil {
+		panic(err)
+	}
+	helpers.SetKeyManager(keys)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	os.Exit(m.Run())
+}
+
+// newServer serves the real router on memory stores, wrap can put a test double in front of it
+func newServer(t *testing.T, wrap func(http.Handler) http.Handler) *httptest.Server {
+	t.Helper()
+
+	var handler http.Handler = api.NewRouter(store.NewMemoryStores(), api.RouterConfig{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// register creates a user and logs the client in
+func register(t *testing.T, c *Client, username string) {
+	t.Helper()
+
+	ctx := context.Background()
+	user := types.RegisterUserRequest{Username: username, Password: testPassword, FirstName: "Test", LastName: "User"}
+	if err := c.Register(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Login(ctx, username, testPassword); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failFirst answers the first n requests with err, then passes requests on
+func failFirst(n int32, err helpers.APIError, retryAfter string, requests *atomic.Int32) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) > n {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			helpers.WriteError(w, r, err)
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	server := newServer(t, nil)
+	c := New(Config{BaseURL: server.URL})
+	register(t, c, "alice")
+
+	token, refreshToken := c.Tokens()
+	if token == "" || refreshToken == "" {
+		t.Fatal("login kept no tokens")
+	}
+
+	user, err := c.Me(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" {
+		t.Fatalf("got user %s, expected alice", user.Username)
+	}
+}
+
+func TestRefreshAfterUnauthorized(t *testing.T) {
+	server := newServer(t, nil)
+	c := New(Config{BaseURL: server.URL})
+	register(t, c, "bob")
+
+	// The server rejects the access token, like an expired one
+	_, refreshToken := c.Tokens()
+	c.SetTokens("expired", refreshToken)
+
+	user, err := c.Me(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "bob" {
+		t.Fatalf("got user %s, expected bob", user.Username)
+	}
+
+	token, newRefreshToken := c.Tokens()
+	if token == "expired" || newRefreshToken == refreshToken {
+		t.Fatal("tokens were not replaced")
+	}
+
+	// Without a refresh token the rejection is returned
+	c.SetTokens("expired", "")
+	_, err = c.Me(context.Background())
+	if !errors.Is(err, ErrUnauthorized) || !errors.Is(err, helpers.BadCredentials()) {
+		t.Fatalf("got %v, expected %v", err, ErrUnauthorized)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := newServer(t, nil)
+	c := New(Config{BaseURL: server.URL})
+	register(t, c, "carol")
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+		kind error
+		code helpers.APIError
+	}{
+		{"unknown book", func() error {
+			_, err := c.GetBook(ctx, 999)
+			return err
+		}, ErrNotFound, helpers.BookNotFound()},
+		{"taken username", func() error {
+			return c.Register(ctx, types.RegisterUserRequest{Username: "carol", Password: testPassword, FirstName: "C", LastName: "C"})
+		}, ErrConflict, helpers.UsernameTaken()},
+		{"missing permission", func() error {
+			return c.CreateBook(ctx, types.AddBookRequest{Name: "Dune", Quantity: 1})
+		}, ErrForbidden, helpers.Forbidden()},
+		{"wrong password", func() error {
+			_, err := New(Config{BaseURL: server.URL}).Login(ctx, "carol", "wrong password")
+			return err
+		}, ErrUnauthorized, helpers.BadCredentials()},
+		{"invalid request", func() error {
+			return c.Register(ctx, types.RegisterUserRequest{Username: "dave"})
+		}, ErrValidation, helpers.ValidationFailed()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.call()
+			if !errors.Is(err, test.kind) {
+				t.Fatalf("got %v, expected %v", err, test.kind)
+			}
+			if !errors.Is(err, test.code) {
+				t.Fatalf("got %v, expected code %s", err, test.code.Code)
+			}
+
+			var apiErr *Error
+			if !errors.As(err, &apiErr) || apiErr.RequestId == "" {
+				t.Fatalf("got %#v, expected an *Error with the request id", err)
+			}
+		})
+	}
+}
+
+func TestValidationErrorHasFields(t *testing.T) {
+	server := newServer(t, nil)
+	c := New(Config{BaseURL: server.URL})
+
+	err := c.Register(context.Background(), types.RegisterUserRequest{Username: "erin", Password: "short", FirstName: "E", LastName: "E"})
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("got %v, expected an *Error", err)
+	}
+	if len(apiErr.Errors) != 1 || apiErr.Errors[0].Field != "password" {
+		t.Fatalf("got field errors %+v, expected password", apiErr.Errors)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int32
+		err        helpers.APIError
+		retryAfter string
+		method     string
+		requests   int32
+		kind       error
+	}{
+		{"unavailable", 2, helpers.Canceled(), "", http.MethodGet, 3, nil},
+		{"too many requests", 1, helpers.TooManyAttempts(), "1", http.MethodGet, 2, nil},
+		{"gives up", 5, helpers.Canceled(), "", http.MethodGet, 3, ErrUnavailable},
+		{"long retry after", 1, helpers.TooManyAttempts(), "60", http.MethodGet, 1, ErrTooManyRequests},
+		{"not idempotent", 1, helpers.Canceled(), "", http.MethodPost, 1, ErrUnavailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := newServer(t, failFirst(test.failures, test.err, test.retryAfter, &requests))
+			c := New(Config{BaseURL: server.URL, RetryBackoff: time.Millisecond})
+
+			start := time.Now()
+			var err error
+			if test.method == http.MethodGet {
+				_, err = c.ListBooks(context.Background())
+			} else {
+				err = c.Register(context.Background(), types.RegisterUserRequest{Username: "frank", Password: testPassword, FirstName: "F", LastName: "F"})
+			}
+
+			if test.kind == nil && err != nil {
+				t.Fatal(err)
+			}
+			if test.kind != nil && !errors.Is(err, test.kind) {
+				t.Fatalf("got %v, expected %v", err, test.kind)
+			}
+			if requests.Load() != test.requests {
+				t.Fatalf("sent %d requests, expected %d", requests.Load(), test.requests)
+			}
+			if test.retryAfter == "1" && time.Since(start) < time.Second {
+				t.Fatal("Retry-After was not honored")
+			}
+		})
+	}
+}
+
+type recordingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Test-Transport", "yes")
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestCustomTransport(t *testing.T) {
+	var seen atomic.Bool
+	server := newServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen.Store(r.Header.Get("X-Test-Transport") == "yes")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	transport := &recordingTransport{}
+	c := New(Config{BaseURL: server.URL, Transport: transport})
+	if _, err := c.ListBooks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if transport.requests.Load() != 1 || !seen.Load() {
+		t.Fatalf("transport sent %d requests, server saw its header: %v", transport.requests.Load(), seen.Load())
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+// Kinds of failed requests, match them with errors.Is
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	// 422, Error.Errors lists the invalid fields
+	ErrValidation      = errors.New("validation failed")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrServer          = errors.New("server error")
+	// 502, 503 and 504, the request may succeed later
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// Error is a failed response. errors.Is matches it against the Err* kinds and, by
+// error code, the helpers.APIError values, e.g. errors.Is(err, helpers.OutOfStock()).
+type Error struct {
+	helpers.APIError
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("book rent api: %s (status %d)", e.Detail(), e.Status)
+	}
+	return fmt.Sprintf("book rent api: %s (status %d, code %s)", e.Detail(), e.Status, e.Code)
+}
+
+func (e *Error) Unwrap() error {
+	return e.APIError
+}
+
+func (e *Error) Is(target error) bool {
+	return kindOf(e.Status) == target
+}
+
+func kindOf(status int) error {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusUnprocessableEntity:
+		return ErrValidation
+	case http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return ErrServer
+	}
+	return nil
+}
+
+// decodeError reads a problem body. Responses of proxies are not JSON, the text
+// or the status text is used for those and Code stays empty.
+func decodeError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var apiErr helpers.APIError
+	if err := json.Unmarshal(body, &apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+	apiErr.Status = resp.StatusCode
+
+	return &Error{APIError: apiErr}
+}
+
+// MFARequiredError is returned by Login when the user has to pass a second factor.
+// Continue with LoginMFA, or with EnrollMFA first when Challenge.EnrollmentRequired is set.
+type MFARequiredError struct {
+	Challenge types.MFAChallengeResponse
+}
+
+func (e *MFARequiredError) Error() string {
+	if e.Challenge.EnrollmentRequired {
+		return "mfa enrollment required"
+	}
+	return "mfa required"
+}
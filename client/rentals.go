@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+// RentBook rents a book for the logged-in user, or for request.UserId
+// with the loans:checkout_for_others permission
+func (c *Client) RentBook(ctx context.Context, request types.RentBookRequest) error {
+	return c.do(ctx, http.MethodPost, "/rent/book", request, nil)
+}
+
+// ReturnBook returns the rental with the given id
+func (c *Client) ReturnBook(ctx context.Context, rentalId string) error {
+	return c.do(ctx, http.MethodPost, "/rent/return", types.ReturnBookRequest{Id: rentalId}, nil)
+}
+
+// MyRentals returns the rentals of the logged-in user
+func (c *Client) MyRentals(ctx context.Context) ([]types.UserRentHistory, error) {
+	var history []types.UserRentHistory
+	err := c.do(ctx, http.MethodGet, "/rent/user-history", nil, &history)
+	return history, err
+}
+
+// RentHistory returns every rental, it needs the loans:manage permission
+func (c *Client) RentHistory(ctx context.Context) ([]types.RentHistory, error) {
+	var history []types.RentHistory
+	err := c.do(ctx, http.MethodGet, "/rent/history", nil, &history)
+	return history, err
+}
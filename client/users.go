@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+var errNoRefreshToken = errors.New("no refresh token")
+
+// Register creates an account, it doesn't log in
+func (c *Client) Register(ctx context.Context, user types.RegisterUserRequest) error {
+	return c.doPublic(ctx, http.MethodPost, "/user/register", user, nil)
+}
+
+// Login logs in with a password and keeps the tokens for later calls.
+// Users with MFA get a *MFARequiredError, see LoginMFA.
+func (c *Client) Login(ctx context.Context, username, password string) (types.LoginResponse, error) {
+	var resp struct {
+		types.LoginResponse
+		types.MFAChallengeResponse
+	}
+	request := types.LoginUserRequest{Username: username, Password: password}
+	if err := c.doPublic(ctx, http.MethodPost, "/user/login", request, &resp); err != nil {
+		return types.LoginResponse{}, err
+	}
+
+	if resp.MFARequired {
+		return types.LoginResponse{}, &MFARequiredError{Challenge: resp.MFAChallengeResponse}
+	}
+
+	c.SetTokens(resp.Token, resp.RefreshToken)
+	return resp.LoginResponse, nil
+}
+
+// EnrollMFA starts the enrollment that a login asked for. Show the secret to the
+// user and finish with LoginMFA and a code of their app.
+func (c *Client) EnrollMFA(ctx context.Context, mfaToken string) (types.MFAEnrollResponse, error) {
+	var resp types.MFAEnrollResponse
+	err := c.doPublic(ctx, http.MethodPost, "/user/login/mfa/enroll", types.MFAEnrollmentRequest{MFAToken: mfaToken}, &resp)
+	return resp, err
+}
+
+// LoginMFA finishes a login with a TOTP or recovery code and keeps the tokens.
+// After an enrollment the response has the recovery codes.
+func (c *Client) LoginMFA(ctx context.Context, mfaToken, code string) (types.LoginResponse, error) {
+	var resp types.LoginResponse
+	request := types.LoginMFARequest{MFAToken: mfaToken, Code: code}
+	if err := c.doPublic(ctx, http.MethodPost, "/user/login/mfa", request, &resp); err != nil {
+		return types.LoginResponse{}, err
+	}
+
+	c.SetTokens(resp.Token, resp.RefreshToken)
+	return resp, nil
+}
+
+// Refresh replaces the tokens now. Calls refresh on their own once the access token expires.
+func (c *Client) Refresh(ctx context.Context) error {
+	token, _ := c.Tokens()
+	_, err := c.refresh(ctx, token)
+	return err
+}
+
+// refresh exchanges the refresh token unless another call already replaced the
+// rejected token. Reusing a refresh token would sign out the session.
+func (c *Client) refresh(ctx context.Context, rejected string) (string, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	token, refreshToken := c.Tokens()
+	if token != rejected {
+		return token, nil
+	}
+	if refreshToken == "" {
+		return "", errNoRefreshToken
+	}
+
+	var resp types.LoginResponse
+	request := types.RefreshTokenRequest{RefreshToken: refreshToken}
+	if err := c.doPublic(ctx, http.MethodPost, "/user/token/refresh", request, &resp); err != nil {
+		return "", err
+	}
+
+	c.SetTokens(resp.Token, resp.RefreshToken)
+	return resp.Token, nil
+}
+
+// Me returns the logged-in user
+func (c *Client) Me(ctx context.Context) (types.User, error) {
+	var user types.User
+	err := c.do(ctx, http.MethodPost, "/user/details", nil, &user)
+	return user, err
+}
+
+// ListUsers needs the users:manage permission, like the calls below
+func (c *Client) ListUsers(ctx context.Context) ([]types.User, error) {
+	var users []types.User
+	err := c.do(ctx, http.MethodGet, "/users", nil, &users)
+	return users, err
+}
+
+func (c *Client) SuspendUser(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/users/"+url.PathEscape(id)+"/suspend", nil, nil)
+}
+
+func (c *Client) UnsuspendUser(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/users/"+url.PathEscape(id)+"/unsuspend", nil, nil)
+}
+
+func (c *Client) SetUserRole(ctx context.Context, id, role string) error {
+	return c.do(ctx, http.MethodPut, "/users/"+url.PathEscape(id)+"/role", types.UpdateUserRoleRequest{Role: role}, nil)
+}
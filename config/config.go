@@ -0,0 +1,365 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/database"
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/server"
+	"github.com/burakiscoding/go-book-rent/tracing"
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+// MinJWTSecretLength is the shortest HS256 secret accepted, 256 bits
+const MinJWTSecretLength = 32
+
+// Config holds every setting of the server. Every leaf field has a key (its path
+// of yaml names, e.g. "database.query_timeout"), which is also its flag name,
+// and an environment variable. Fields marked secret are redacted when printed.
+type Config struct {
+	Store    string         `yaml:"store" toml:"store" env:"STORE" help:"storage backend: sql or memory"`
+	HTTP     HTTPConfig     `yaml:"http" toml:"http"`
+	Log      LogConfig      `yaml:"log" toml:"log"`
+	Metrics  MetricsConfig  `yaml:"metrics" toml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing" toml:"tracing"`
+	Database DatabaseConfig `yaml:"database" toml:"database"`
+	Auth     AuthConfig     `yaml:"auth" toml:"auth"`
+	Password PasswordConfig `yaml:"password" toml:"password"`
+	Rental   RentalConfig   `yaml:"rental" toml:"rental"`
+
+	// where every key got its value from
+	sources map[string]string
+}
+
+type HTTPConfig struct {
+	Addr              string        `yaml:"addr" toml:"addr" env:"HTTP_ADDR" help:"address the server listens on"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"HTTP_READ_TIMEOUT" help:"maximum time to read a request"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" help:"maximum time to read request headers"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" help:"maximum time to write a response"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" help:"how long idle keep-alive connections stay open"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES" help:"maximum size of request headers"`
+	MaxBodyBytes      int           `yaml:"max_body_bytes" toml:"max_body_bytes" env:"HTTP_MAX_BODY_BYTES" help:"maximum size of a request body, 0 is unlimited"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" help:"how long in-flight requests get to finish on shutdown"`
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay" toml:"shutdown_delay" env:"HTTP_SHUTDOWN_DELAY" help:"how long /readyz fails before connections are drained"`
+	HealthTimeout     time.Duration `yaml:"health_timeout" toml:"health_timeout" env:"HTTP_HEALTH_TIMEOUT" help:"timeout of each readiness check"`
+	TLSCertFile       string        `yaml:"tls_cert_file" toml:"tls_cert_file" env:"TLS_CERT_FILE" help:"PEM certificate chain, enables TLS with tls_key_file"`
+	TLSKeyFile        string        `yaml:"tls_key_file" toml:"tls_key_file" env:"TLS_KEY_FILE" help:"PEM private key of the certificate"`
+	TLSReloadInterval time.Duration `yaml:"tls_reload_interval" toml:"tls_reload_interval" env:"TLS_RELOAD_INTERVAL" help:"how often certificate files are checked for changes, 0 only reloads on SIGHUP"`
+}
+
+type LogConfig struct {
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" help:"text or json"`
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" help:"debug, info, warn or error"`
+}
+
+type MetricsConfig struct {
+	Addr          string        `yaml:"addr" toml:"addr" env:"METRICS_ADDR" help:"separate plain HTTP listener serving /metrics without authentication, e.g. 127.0.0.1:9090"`
+	ScrapeTimeout time.Duration `yaml:"scrape_timeout" toml:"scrape_timeout" env:"METRICS_SCRAPE_TIMEOUT" help:"timeout of the store queries run on every scrape"`
+}
+
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER" help:"where spans are sent: none, stdout or otlp"`
+	ServiceName  string  `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME" help:"service.name of the spans"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint" toml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT" help:"OTLP/HTTP collector URL, empty uses the OTEL_EXPORTER_OTLP_* variables"`
+	SampleRatio  float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" help:"fraction of new traces recorded, incoming sampled traces are always recorded"`
+}
+
+type DatabaseConfig struct {
+	Driver          string        `yaml:"driver" toml:"driver" env:"DB_DRIVER" help:"mysql, postgres or sqlite"`
+	Host            string        `yaml:"host" toml:"host" env:"DB_HOST" help:"database host and port"`
+	Name            string        `yaml:"name" toml:"name" env:"DB_NAME" help:"database name, the file path for sqlite"`
+	Username        string        `yaml:"username" toml:"username" env:"DB_USERNAME" help:"database user"`
+	Password        string        `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true" help:"database password"`
+	QueryTimeout    time.Duration `yaml:"query_timeout" toml:"query_timeout" env:"DB_QUERY_TIMEOUT" help:"timeout of one store call, 0 disables it"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" help:"maximum open connections, 0 is unlimited"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" help:"maximum idle connections, 0 keeps the default"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" help:"maximum lifetime of a connection, 0 is unlimited"`
+	AutoMigrate     bool          `yaml:"auto_migrate" toml:"auto_migrate" env:"DB_AUTO_MIGRATE" help:"apply pending migrations on start"`
+}
+
+type AuthConfig struct {
+	JWTSecret         string        `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" secret:"true" help:"HS256 signing secret, used without a keys directory"`
+	JWTKeysDir        string        `yaml:"jwt_keys_dir" toml:"jwt_keys_dir" env:"JWT_KEYS_DIR" help:"directory of asymmetric signing keys"`
+	JWTActiveKeyId    string        `yaml:"jwt_active_key_id" toml:"jwt_active_key_id" env:"JWT_ACTIVE_KEY_ID" help:"key id used for signing"`
+	RequireAdminMFA   bool          `yaml:"require_admin_mfa" toml:"require_admin_mfa" env:"MFA_REQUIRED_FOR_ADMIN" help:"admins must use two-factor authentication"`
+	SetupTokenEnabled bool          `yaml:"setup_token_enabled" toml:"setup_token_enabled" env:"SETUP_TOKEN_ENABLED" help:"print a one-time token for creating the first admin"`
+	LoginAttemptStore string        `yaml:"login_attempt_store" toml:"login_attempt_store" env:"LOGIN_ATTEMPT_STORE" help:"where failed logins are kept: memory or sql"`
+	LoginWindow       time.Duration `yaml:"login_window" toml:"login_window" env:"LOGIN_WINDOW" help:"failed logins older than this are forgotten"`
+	LockoutAfter      int           `yaml:"lockout_after" toml:"lockout_after" env:"LOGIN_LOCKOUT_AFTER" help:"failed logins before the account is locked"`
+	LockoutDuration   time.Duration `yaml:"lockout_duration" toml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION" help:"how long a locked account stays locked"`
+	OIDC              OIDCConfig    `yaml:"oidc" toml:"oidc"`
+}
+
+type OIDCConfig struct {
+	Issuer       string `yaml:"issuer" toml:"issuer" env:"OIDC_ISSUER" help:"OpenID Connect issuer URL, empty disables it"`
+	ClientId     string `yaml:"client_id" toml:"client_id" env:"OIDC_CLIENT_ID" help:"OpenID Connect client id"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true" help:"OpenID Connect client secret"`
+	RedirectURL  string `yaml:"redirect_url" toml:"redirect_url" env:"OIDC_REDIRECT_URL" help:"OpenID Connect callback URL"`
+}
+
+type PasswordConfig struct {
+	HashAlgorithm     string `yaml:"hash_algorithm" toml:"hash_algorithm" env:"PASSWORD_HASH_ALGORITHM" help:"argon2id or bcrypt"`
+	Argon2MemoryKiB   uint32 `yaml:"argon2_memory_kib" toml:"argon2_memory_kib" env:"ARGON2_MEMORY_KIB" help:"argon2id memory in KiB"`
+	Argon2Iterations  uint32 `yaml:"argon2_iterations" toml:"argon2_iterations" env:"ARGON2_ITERATIONS" help:"argon2id iterations"`
+	Argon2Parallelism uint32 `yaml:"argon2_parallelism" toml:"argon2_parallelism" env:"ARGON2_PARALLELISM" help:"argon2id parallelism"`
+	BcryptCost        int    `yaml:"bcrypt_cost" toml:"bcrypt_cost" env:"BCRYPT_COST" help:"bcrypt cost"`
+	MinLength         int    `yaml:"min_length" toml:"min_length" env:"PASSWORD_MIN_LENGTH" help:"minimum password length"`
+	BreachedListFile  string `yaml:"breached_list_file" toml:"breached_list_file" env:"PASSWORD_BREACHED_LIST_FILE" help:"file of breached passwords or SHA-1 hashes"`
+}
+
+type RentalConfig struct {
+	MinDays int `yaml:"min_days" toml:"min_days" env:"RENTAL_MIN_DAYS" help:"shortest rent in days, at least 1"`
+	MaxDays int `yaml:"max_days" toml:"max_days" env:"RENTAL_MAX_DAYS" help:"longest rent in days, at most 30"`
+}
+
+func Default() Config {
+	argon := helpers.DefaultArgon2idHasher()
+
+	return Config{
+		Store: "sql",
+		HTTP: HTTPConfig{
+			Addr:              ":8080",
+			ReadTimeout:       time.Second * 15,
+			ReadHeaderTimeout: time.Second * 5,
+			WriteTimeout:      time.Second * 30,
+			IdleTimeout:       time.Minute * 2,
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      1 << 20,
+			ShutdownTimeout:   time.Second * 30,
+			HealthTimeout:     time.Second * 2,
+			TLSReloadInterval: time.Minute,
+		},
+		Log: LogConfig{
+			Format: "text",
+			Level:  "info",
+		},
+		Metrics: MetricsConfig{
+			ScrapeTimeout: time.Second * 5,
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracing.ExporterNone,
+			ServiceName: "book-rent",
+			SampleRatio: 1,
+		},
+		Database: DatabaseConfig{
+			Driver:       "mysql",
+			QueryTimeout: database.DefaultQueryTimeout,
+		},
+		Auth: AuthConfig{
+			LoginAttemptStore: "memory",
+			LoginWindow:       time.Minute * 15,
+			LockoutAfter:      10,
+			LockoutDuration:   time.Minute * 15,
+		},
+		Password: PasswordConfig{
+			HashAlgorithm:     "argon2id",
+			Argon2MemoryKiB:   argon.Memory,
+			Argon2Iterations:  argon.Iterations,
+			Argon2Parallelism: uint32(argon.Parallelism),
+			BcryptCost:        10,
+			MinLength:         helpers.DefaultPasswordPolicy().MinLength,
+		},
+		Rental: RentalConfig{
+			MinDays: types.MinRentTimeInDays,
+			MaxDays: types.MaxRentTimeInDays,
+		},
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Store == "sql" || c.Store == "memory", "store must be sql or memory, got %q", c.Store)
+	check(c.HTTP.Addr != "", "http.addr is required")
+	check(c.HTTP.ReadTimeout >= 0 && c.HTTP.ReadHeaderTimeout >= 0 && c.HTTP.WriteTimeout >= 0 && c.HTTP.IdleTimeout >= 0, "http timeouts can't be negative")
+	check(c.HTTP.MaxHeaderBytes >= 0, "http.max_header_bytes can't be negative")
+	check(c.HTTP.MaxBodyBytes >= 0, "http.max_body_bytes can't be negative")
+	check(c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout must be positive")
+	check(c.HTTP.ShutdownDelay >= 0, "http.shutdown_delay can't be negative")
+	check(c.HTTP.HealthTimeout > 0, "http.health_timeout must be positive")
+	check((c.HTTP.TLSCertFile == "") == (c.HTTP.TLSKeyFile == ""), "http.tls_cert_file and http.tls_key_file must be set together")
+	check(c.HTTP.TLSReloadInterval >= 0, "http.tls_reload_interval can't be negative")
+
+	if _, err := c.Log.Logger(io.Discard); err != nil {
+		check(false, "log: %v", err)
+	}
+
+	check(c.Metrics.Addr == "" || c.Metrics.Addr != c.HTTP.Addr, "metrics.addr must differ from http.addr")
+	check(c.Metrics.ScrapeTimeout > 0, "metrics.scrape_timeout must be positive")
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		check(false, "tracing.exporter must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.ServiceName != "", "tracing.service_name is required")
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	errs = append(errs, c.databaseErrors()...)
+
+	if c.Auth.JWTKeysDir == "" {
+		check(len(c.Auth.JWTSecret) >= MinJWTSecretLength, "auth.jwt_secret must be at least %d bytes when auth.jwt_keys_dir is not set", MinJWTSecretLength)
+	}
+	check(c.Auth.LoginAttemptStore == "memory" || c.Auth.LoginAttemptStore == "sql", "auth.login_attempt_store must be memory or sql, got %q", c.Auth.LoginAttemptStore)
+	check(c.Auth.LoginAttemptStore != "sql" || c.Store == "sql", "auth.login_attempt_store sql needs store sql")
+	check(c.Auth.LoginWindow > 0, "auth.login_window must be positive")
+	check(c.Auth.LockoutAfter > 0, "auth.lockout_after must be positive")
+	check(c.Auth.LockoutDuration > 0, "auth.lockout_duration must be positive")
+	if c.Auth.OIDC.Issuer != "" {
+		check(c.Auth.OIDC.ClientId != "", "auth.oidc.client_id is required with auth.oidc.issuer")
+		check(c.Auth.OIDC.RedirectURL != "", "auth.oidc.redirect_url is required with auth.oidc.issuer")
+	}
+
+	errs = append(errs, c.passwordErrors()...)
+
+	check(c.Rental.MinDays >= types.MinRentTimeInDays, "rental.min_days must be at least %d", types.MinRentTimeInDays)
+	check(c.Rental.MaxDays <= types.MaxRentTimeInDays, "rental.max_days must be at most %d", types.MaxRentTimeInDays)
+	check(c.Rental.MaxDays >= c.Rental.MinDays, "rental.max_days can't be less than rental.min_days")
+
+	return errors.Join(errs...)
+}
+
+// ValidateOps checks the settings of the commands that work on the database directly:
+// migrate, admin, books, users and loans. They don't serve the API, so the HTTP, auth
+// and tracing settings don't matter. The memory store is refused, it would forget the
+// changes of the command as soon as it exits.
+func (c Config) ValidateOps() error {
+	var errs []error
+	if c.Store != "sql" {
+		errs = append(errs, fmt.Errorf("store must be sql, got %q", c.Store))
+	}
+	errs = append(errs, c.databaseErrors()...)
+	errs = append(errs, c.passwordErrors()...)
+
+	return errors.Join(errs...)
+}
+
+func (c Config) databaseErrors() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if c.Store == "sql" {
+		_, err := database.DriverName(c.Database.Driver)
+		check(err == nil, "database.driver must be mysql, postgres or sqlite, got %q", c.Database.Driver)
+		check(c.Database.Name != "", "database.name is required")
+		check(c.Database.Driver == "sqlite" || c.Database.Host != "", "database.host is required")
+	}
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout can't be negative")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns can't be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns can't be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime can't be negative")
+
+	return errs
+}
+
+func (c Config) passwordErrors() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	switch c.Password.HashAlgorithm {
+	case "argon2id":
+		check(c.Password.Argon2MemoryKiB >= 8*c.Password.Argon2Parallelism, "password.argon2_memory_kib must be at least 8 times password.argon2_parallelism")
+		check(c.Password.Argon2Iterations >= 1, "password.argon2_iterations must be at least 1")
+		check(c.Password.Argon2Parallelism >= 1 && c.Password.Argon2Parallelism <= 255, "password.argon2_parallelism must be between 1 and 255")
+	case "bcrypt":
+		check(c.Password.BcryptCost >= 4 && c.Password.BcryptCost <= 31, "password.bcrypt_cost must be between 4 and 31")
+	default:
+		check(false, "password.hash_algorithm must be argon2id or bcrypt, got %q", c.Password.HashAlgorithm)
+	}
+	check(c.Password.MinLength >= 1, "password.min_length must be at least 1")
+
+	return errs
+}
+
+// Server returns the settings of the server package
+func (c HTTPConfig) Server() server.Config {
+	return server.Config{
+		Addr:              c.Addr,
+		ReadTimeout:       c.ReadTimeout,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+		MaxBodyBytes:      int64(c.MaxBodyBytes),
+		ShutdownTimeout:   c.ShutdownTimeout,
+		ShutdownDelay:     c.ShutdownDelay,
+		TLSCertFile:       c.TLSCertFile,
+		TLSKeyFile:        c.TLSKeyFile,
+		TLSReloadInterval: c.TLSReloadInterval,
+	}
+}
+
+// MetricsServer returns the settings of the separate metrics listener,
+// the timeouts of the main server without TLS
+func (c Config) MetricsServer() server.Config {
+	config := c.HTTP.Server()
+	config.Addr = c.Metrics.Addr
+	config.TLSCertFile = ""
+	config.TLSKeyFile = ""
+	config.ShutdownDelay = 0
+
+	return config
+}
+
+// Tracing returns the settings of the tracing package
+func (c TracingConfig) Tracing() tracing.Config {
+	return tracing.Config{
+		Exporter:     c.Exporter,
+		ServiceName:  c.ServiceName,
+		OTLPEndpoint: c.OTLPEndpoint,
+		SampleRatio:  c.SampleRatio,
+	}
+}
+
+// Logger builds the configured logger writing to w
+func (c LogConfig) Logger(w io.Writer) (*slog.Logger, error) {
+	return helpers.NewLogger(w, c.Format, c.Level)
+}
+
+// SQL returns the connection settings of the database package
+func (c DatabaseConfig) SQL() (database.Config, error) {
+	driver, err := database.DriverName(c.Driver)
+	if err != nil {
+		return database.Config{}, err
+	}
+
+	return database.Config{
+		Driver:          driver,
+		Username:        c.Username,
+		Password:        c.Password,
+		Host:            c.Host,
+		Name:            c.Name,
+		QueryTimeout:    c.QueryTimeout,
+		MaxOpenConns:    c.MaxOpenConns,
+		MaxIdleConns:    c.MaxIdleConns,
+		ConnMaxLifetime: c.ConnMaxLifetime,
+	}, nil
+}
+
+// PasswordHasher builds the configured hasher
+func (c PasswordConfig) PasswordHasher() (helpers.PasswordHasher, error) {
+	argon := helpers.DefaultArgon2idHasher()
+	argon.Memory = c.Argon2MemoryKiB
+	argon.Iterations = c.Argon2Iterations
+	argon.Parallelism = uint8(c.Argon2Parallelism)
+
+	return helpers.NewPasswordHasher(c.HashAlgorithm, argon, c.BcryptCost)
+}
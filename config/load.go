@@ -0,0 +1,258 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// sources of a value, from the lowest precedence to the highest
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// field is one leaf setting of Config
+type field struct {
+	key    string
+	env    string
+	help   string
+	secret bool
+	value  reflect.Value
+}
+
+// fields walks the struct and returns its leaf settings in declaration order
+func fields(c *Config) []field {
+	var result []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+
+			key := prefix + sf.Tag.Get("yaml")
+			if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) {
+				walk(v.Field(i), key+".")
+				continue
+			}
+
+			result = append(result, field{
+				key:    key,
+				env:    sf.Tag.Get("env"),
+				help:   sf.Tag.Get("help"),
+				secret: sf.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+
+	return result
+}
+
+func (f field) set(s string) error {
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(n))
+	case float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetFloat(n)
+	case uint32:
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return err
+		}
+		f.value.SetUint(n)
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(d))
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Type())
+	}
+
+	return nil
+}
+
+func (f field) String() string {
+	if d, ok := f.value.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	return fmt.Sprint(f.value.Interface())
+}
+
+// Load builds the config from, lowest precedence first: defaults, the config file,
+// environment variables (a .env file is read if present) and flags.
+// The file is given with -config or BOOK_RENT_CONFIG, .yaml/.yml or .toml.
+// It returns the arguments left after the flags, e.g. a subcommand.
+// The result is not validated, see Validate.
+func Load(args []string) (Config, []string, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, nil, err
+	}
+
+	cfg := Default()
+	cfg.sources = make(map[string]string)
+	all := fields(&cfg)
+	for _, f := range all {
+		cfg.sources[f.key] = sourceDefault
+	}
+
+	flags := flag.NewFlagSet("book-rent", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("BOOK_RENT_CONFIG"), "path of a YAML or TOML config file")
+	flagValues := make(map[string]*string)
+	for _, f := range all {
+		usage := f.help
+		if f.env != "" {
+			usage += " (env " + f.env + ")"
+		}
+		flagValues[f.key] = flags.String(f.key, "", usage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	if *path != "" {
+		before := snapshot(all)
+		if err := loadFile(*path, &cfg); err != nil {
+			return Config{}, nil, err
+		}
+		for i, f := range all {
+			if f.String() != before[i] {
+				cfg.sources[f.key] = sourceFile
+			}
+		}
+	}
+
+	for _, f := range all {
+		value, ok := os.LookupEnv(f.env)
+		if f.env == "" || !ok {
+			continue
+		}
+		if err := f.set(value); err != nil {
+			return Config{}, nil, fmt.Errorf("%s: %w", f.env, err)
+		}
+		cfg.sources[f.key] = sourceEnv
+	}
+
+	var flagErr error
+	flags.Visit(func(fl *flag.Flag) {
+		for _, f := range all {
+			if f.key != fl.Name || flagErr != nil {
+				continue
+			}
+			if err := f.set(*flagValues[f.key]); err != nil {
+				flagErr = fmt.Errorf("-%s: %w", f.key, err)
+			}
+			cfg.sources[f.key] = sourceFlag
+		}
+	})
+	if flagErr != nil {
+		return Config{}, nil, flagErr
+	}
+
+	// Older names
+	if cfg.Store == "mysql" {
+		cfg.Store = "sql"
+	}
+	if cfg.Auth.LoginAttemptStore == "mysql" {
+		cfg.Auth.LoginAttemptStore = "sql"
+	}
+
+	return cfg, flags.Args(), nil
+}
+
+func snapshot(all []field) []string {
+	values := make([]string, len(all))
+	for i, f := range all {
+		values[i] = f.String()
+	}
+
+	return values
+}
+
+// loadFile decodes a YAML or TOML file on top of the current values.
+// Unknown keys are rejected so typos don't go unnoticed.
+func loadFile(path string, cfg *Config) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(content)))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(content), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("%s: config file must be .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
+
+// Print writes the effective values and where they came from, secrets are redacted
+func (c Config) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, f := range fields(&c) {
+		value := f.String()
+		if f.secret && value != "" {
+			value = "<redacted>"
+		}
+
+		source := c.sources[f.key]
+		if source == "" {
+			source = sourceDefault
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.key, value, source)
+	}
+
+	return tw.Flush()
+}
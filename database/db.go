@@ -1,41 +1,238 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"os"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	_ "modernc.org/sqlite"
+)
+
+// database/sql driver names
+const (
+	DriverMysql    = "mysql"
+	DriverPostgres = "pgx"
+	DriverSQLite   = "sqlite"
 )
 
-const DriverMysql = "mysql"
+// DefaultQueryTimeout bounds every store call unless configured otherwise
+const DefaultQueryTimeout = 5 * time.Second
 
 type Config struct {
-	Driver   string
-	Username string
-	Password string
-	Host     string
-	Name     string
+	Driver       string
+	Username     string
+	Password     string
+	Host         string
+	Name         string
+	QueryTimeout time.Duration
+	// Connection pool, zero keeps the database/sql defaults
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
 }
 
-// default database config
-func NewConfig() Config {
-	return Config{
-		Driver:   DriverMysql,
-		Username: os.Getenv("DB_USERNAME"),
-		Password: os.Getenv("DB_PASSWORD"),
-		Host:     os.Getenv("DB_HOST"),
-		Name:     os.Getenv("DB_NAME"),
+// DriverName returns the database/sql driver of mysql, postgres or sqlite
+func DriverName(name string) (string, error) {
+	switch name {
+	case "mysql":
+		return DriverMysql, nil
+	case "postgres":
+		return DriverPostgres, nil
+	case "sqlite":
+		return DriverSQLite, nil
+	default:
+		return "", fmt.Errorf("unsupported database driver: %s", name)
 	}
 }
 
-func NewSQLWithConfig(config Config) (*sql.DB, error) {
-	dataSourceName := config.Username + ":" + config.Password + "@(" + config.Host + ")/" + config.Name + "?parseTime=true"
+// DB rebinds every query for the dialect of the driver, so stores can use "?" placeholders
+type DB struct {
+	*sql.DB
+	Dialect      Dialect
+	QueryTimeout time.Duration
+}
+
+func NewSQLWithConfig(config Config) (*DB, error) {
+	var dataSourceName string
+	var dialect Dialect
+	switch config.Driver {
+	case DriverMysql:
+		// clientFoundRows makes RowsAffected count matched rows, an UPDATE that changes nothing still finds its row
+		dataSourceName = config.Username + ":" + config.Password + "@(" + config.Host + ")/" + config.Name + "?parseTime=true&clientFoundRows=true"
+		dialect = DialectMySQL
+	case DriverPostgres:
+		u := url.URL{
+			Scheme: "postgres",
+			User:   url.UserPassword(config.Username, config.Password),
+			Host:   config.Host,
+			Path:   "/" + config.Name,
+		}
+		dataSourceName = u.String()
+		dialect = DialectPostgres
+	case DriverSQLite:
+		dataSourceName = "file:" + config.Name + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+		dialect = DialectSQLite
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", config.Driver)
+	}
+
+	db, err := sql.Open(config.Driver, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
 
-	return sql.Open(config.Driver, dataSourceName)
+	if config.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(config.MaxOpenConns)
+	}
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	if config.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	}
+
+	// SQLite allows one writer at a time, a single connection avoids "database is locked" errors
+	if config.Driver == DriverSQLite {
+		db.SetMaxOpenConns(1)
+	}
+
+	return &DB{DB: db, Dialect: dialect, QueryTimeout: config.QueryTimeout}, nil
 }
 
-// default sql connection
-func NewSQL() (*sql.DB, error) {
-	config := NewConfig()
-	dataSourceName := config.Username + ":" + config.Password + "@(" + config.Host + ")/" + config.Name + "?parseTime=true"
+// WithTimeout bounds one store call by the query timeout.
+// The caller's context still cancels it earlier, e.g. when the client disconnects.
+func (db *DB) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, db.QueryTimeout)
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	query = db.Dialect.Rebind(query)
+	ctx, span := db.Dialect.startSpan(ctx, query)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (db *DB) QueryRow(query string, args ...any) *Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	query = db.Dialect.Rebind(query)
+	ctx, span := db.Dialect.startSpan(ctx, query)
+	return &Row{Row: db.DB.QueryRowContext(ctx, query, args...), span: span}
+}
+
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	query = db.Dialect.Rebind(query)
+	ctx, span := db.Dialect.startSpan(ctx, query)
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return result, err
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	return db.BeginTx(context.Background(), nil)
+}
+
+// BeginTx starts a transaction span, its statements are traced as children of it
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	ctx, span := tracer.Start(ctx, "transaction", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(db.Dialect.system()))
+
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, Dialect: db.Dialect, span: span}, nil
+}
+
+// Tx rebinds and traces queries like DB
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+	span    trace.Span
+	ended   bool
+}
+
+func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return tx.QueryContext(context.Background(), query, args...)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	query = tx.Dialect.Rebind(query)
+	ctx, span := tx.Dialect.startSpan(trace.ContextWithSpan(ctx, tx.span), query)
+	rows, err := tx.Tx.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (tx *Tx) QueryRow(query string, args ...any) *Row {
+	return tx.QueryRowContext(context.Background(), query, args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	query = tx.Dialect.Rebind(query)
+	ctx, span := tx.Dialect.startSpan(trace.ContextWithSpan(ctx, tx.span), query)
+	return &Row{Row: tx.Tx.QueryRowContext(ctx, query, args...), span: span}
+}
+
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return tx.ExecContext(context.Background(), query, args...)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	query = tx.Dialect.Rebind(query)
+	ctx, span := tx.Dialect.startSpan(trace.ContextWithSpan(ctx, tx.span), query)
+	result, err := tx.Tx.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return result, err
+}
+
+func (tx *Tx) Commit() error {
+	err := tx.Tx.Commit()
+	tx.endSpan(err == nil, err)
+	return err
+}
+
+// Rollback after Commit only returns sql.ErrTxDone, like the deferred rollbacks of the stores
+func (tx *Tx) Rollback() error {
+	err := tx.Tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		tx.endSpan(false, nil)
+	} else {
+		tx.endSpan(false, err)
+	}
+	return err
+}
+
+// endSpan ends the transaction span once, on the first Commit or Rollback
+func (tx *Tx) endSpan(committed bool, err error) {
+	if tx.ended {
+		return
+	}
+	tx.ended = true
 
-	return sql.Open(config.Driver, dataSourceName)
+	tx.span.SetAttributes(attribute.Bool("db.transaction.committed", committed))
+	endSpan(tx.span, err)
 }
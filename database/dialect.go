@@ -0,0 +1,82 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect hides the SQL differences between the supported databases.
+// Queries are written with "?" placeholders and rebound for the driver.
+type Dialect struct {
+	Name string
+}
+
+var (
+	DialectMySQL    = Dialect{Name: "mysql"}
+	DialectPostgres = Dialect{Name: "postgres"}
+	DialectSQLite   = Dialect{Name: "sqlite"}
+)
+
+// Rebind replaces "?" placeholders with "$1", "$2"... for PostgreSQL
+func (d Dialect) Rebind(query string) string {
+	if d != DialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// InsertIgnore returns an insert that does nothing if the row already exists
+func (d Dialect) InsertIgnore(table string, columns ...string) string {
+	insert := "INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + placeholders(len(columns)) + ")"
+	if d == DialectMySQL {
+		return "INSERT IGNORE " + insert
+	}
+
+	return "INSERT " + insert + " ON CONFLICT DO NOTHING"
+}
+
+// Upsert returns an insert that updates the given columns if a row with the same keys exists
+func (d Dialect) Upsert(table string, columns, keys, update []string) string {
+	query := "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + placeholders(len(columns)) + ")"
+
+	sets := make([]string, len(update))
+	for i, c := range update {
+		if d == DialectMySQL {
+			sets[i] = c + " = VALUES(" + c + ")"
+		} else {
+			sets[i] = c + " = excluded." + c
+		}
+	}
+
+	if d == DialectMySQL {
+		return query + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	}
+
+	return query + " ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// ForUpdate locks the selected rows until the transaction ends.
+// SQLite has no row locks, it allows a single writer at a time anyway.
+func (d Dialect) ForUpdate() string {
+	if d == DialectSQLite {
+		return ""
+	}
+
+	return " FOR UPDATE"
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// IsUniqueViolation reports whether err comes from a UNIQUE or PRIMARY KEY constraint
+func IsUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	var pgErr *pgconn.PgError
+	var sqliteErr *sqlite.Error
+
+	switch {
+	case errors.As(err, &mysqlErr):
+		return mysqlErr.Number == 1062 // ER_DUP_ENTRY
+	case errors.As(err, &pgErr):
+		return pgErr.Code == "23505" // unique_violation
+	case errors.As(err, &sqliteErr):
+		code := sqliteErr.Code()
+		return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+
+	return false
+}
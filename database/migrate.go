@@ -0,0 +1,344 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// name of the MySQL lock and key of the PostgreSQL advisory lock held while migrating
+const (
+	migrationLockName = "book_rent_migrations"
+	migrationLockId   = 7283610519
+)
+
+// Migration is one versioned schema change, loaded from
+// migrations/<dialect>/<version>_<name>.up.sql and .down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations of a dialect, oldest first
+func Migrations(dialect Dialect) ([]Migration, error) {
+	dir := "migrations/" + dialect.Name
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionStr, migrationName, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+
+		content, err := fs.ReadFile(migrationFiles, dir+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: migrationName}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration and returns the applied ones
+func (db *DB) MigrateUp(ctx context.Context) ([]Migration, error) {
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	err = db.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		done, err := db.appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+
+			insert := "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"
+			if err := db.runMigration(ctx, conn, m.Up, insert, m.Version, m.Name, time.Now()); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// MigrateDown reverts the last applied migrations, newest first
+func (db *DB) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	err = db.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		done, err := db.appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %d_%s can't be reverted", m.Version, m.Name)
+			}
+
+			if err := db.runMigration(ctx, conn, m.Down, "DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// MigrationStatus lists every known migration and when it was applied
+func (db *DB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := db.createMigrationsTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	done, err := db.appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Migration: m}
+		if at, ok := done[m.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+
+	return statuses, nil
+}
+
+// CheckMigrations fails if a migration is not applied yet. Unlike MigrationStatus
+// it never creates the schema_migrations table, it is safe for health checks.
+func (db *DB) CheckMigrations(ctx context.Context) error {
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d pending migrations", pending)
+	}
+
+	return nil
+}
+
+// withMigrationLock runs f on a single connection holding a database wide lock,
+// so replicas starting at the same time don't apply the same migration twice.
+// SQLite has no such lock, the database is a local file of one process.
+func (db *DB) withMigrationLock(ctx context.Context, f func(conn *sql.Conn) error) error {
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch db.Dialect {
+	case DialectMySQL:
+		var locked sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", migrationLockName).Scan(&locked); err != nil {
+			return err
+		}
+		if locked.Int64 != 1 {
+			return errors.New("timed out waiting for the migration lock")
+		}
+		defer conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockName).Scan(&locked)
+	case DialectPostgres:
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockId); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockId)
+	}
+
+	if err := db.createMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+func (db *DB) createMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	timeType := "DATETIME"
+	if db.Dialect == DialectPostgres {
+		timeType = "TIMESTAMP"
+	}
+
+	query := "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at " + timeType + " NOT NULL)"
+	_, err := conn.ExecContext(ctx, query)
+	return err
+}
+
+func (db *DB) appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+// runMigration executes the statements of a migration file and records it in one transaction.
+// MySQL commits DDL implicitly, a failing MySQL migration has to be cleaned up by hand.
+func (db *DB) runMigration(ctx context.Context, conn *sql.Conn, script, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range splitStatements(script) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, db.Dialect.Rebind(record), args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// splitStatements splits a migration file on ";", the drivers run one statement per call.
+// Comment lines are dropped. Statements must not contain ";" in string literals.
+func splitStatements(script string) []string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var statements []string
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	return statements
+}
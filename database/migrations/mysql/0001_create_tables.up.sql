@@ -0,0 +1,104 @@
+CREATE TABLE IF NOT EXISTS books (
+    id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at DATETIME NULL,
+    quantity INT DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(40) NOT NULL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    first_name TEXT NOT NULL,
+    last_name TEXT NOT NULL,
+    created_at DATETIME NULL,
+    role VARCHAR(32) DEFAULT 'user'
+);
+
+CREATE TABLE IF NOT EXISTS book_rent_history (
+    id VARCHAR(40) NOT NULL PRIMARY KEY,
+    book_id INT NOT NULL,
+    user_id VARCHAR(40) NOT NULL,
+    rent_start_time DATETIME NULL,
+    rent_return_time DATETIME NULL,
+    rent_duration_in_days INT NOT NULL,
+    INDEX idx_book_rent_history_book_id (book_id),
+    INDEX idx_book_rent_history_user_id (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(32) NOT NULL PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name VARCHAR(64) NOT NULL PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role VARCHAR(32) NOT NULL,
+    permission VARCHAR(64) NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id VARCHAR(40) NOT NULL PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    enabled TINYINT(1) NOT NULL DEFAULT 0,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    user_id VARCHAR(40) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at DATETIME NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    attempt_key VARCHAR(255) NOT NULL,
+    attempted_at DATETIME NOT NULL,
+    INDEX idx_login_attempts_attempt_key (attempt_key)
+);
+
+CREATE TABLE IF NOT EXISTS account_lockouts (
+    username VARCHAR(255) NOT NULL PRIMARY KEY,
+    locked_until DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id VARCHAR(40) NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL,
+    prefix VARCHAR(16) NOT NULL UNIQUE,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes TEXT NOT NULL,
+    created_by VARCHAR(40) NOT NULL,
+    created_at DATETIME NULL,
+    expires_at DATETIME NULL,
+    last_used_at DATETIME NULL,
+    revoked_at DATETIME NULL,
+    INDEX idx_api_keys_created_by (created_by)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id VARCHAR(40) NOT NULL,
+    created_at DATETIME NULL,
+    PRIMARY KEY (issuer, subject),
+    INDEX idx_user_identities_user_id (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(40) NOT NULL PRIMARY KEY,
+    user_id VARCHAR(40) NOT NULL,
+    user_agent TEXT NOT NULL,
+    ip VARCHAR(64) NOT NULL,
+    refresh_token_hash VARCHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL,
+    INDEX idx_sessions_user_id (user_id)
+);
@@ -0,0 +1,9 @@
+INSERT IGNORE INTO roles (name) VALUES ('user'), ('librarian'), ('admin');
+
+INSERT IGNORE INTO permissions (name) VALUES
+    ('books:write'), ('loans:manage'), ('loans:checkout_for_others'), ('users:manage'), ('api_keys:manage');
+
+INSERT IGNORE INTO role_permissions (role, permission) VALUES
+    ('librarian', 'books:write'), ('librarian', 'loans:manage'), ('librarian', 'loans:checkout_for_others'),
+    ('admin', 'books:write'), ('admin', 'loans:manage'), ('admin', 'loans:checkout_for_others'), ('admin', 'users:manage'),
+    ('admin', 'api_keys:manage');
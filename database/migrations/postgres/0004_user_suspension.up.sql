@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP NULL;
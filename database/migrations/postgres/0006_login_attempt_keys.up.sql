@@ -0,0 +1,4 @@
+CREATE TABLE login_attempt_keys (
+    attempt_key VARCHAR(255) NOT NULL PRIMARY KEY,
+    touched_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS account_lockouts;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS book_rent_history;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS books;
@@ -0,0 +1,2 @@
+DELETE FROM role_permissions WHERE permission = 'metrics:read';
+DELETE FROM permissions WHERE name = 'metrics:read';
@@ -0,0 +1,3 @@
+INSERT INTO permissions (name) VALUES ('metrics:read');
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'metrics:read');
@@ -0,0 +1 @@
+CREATE INDEX idx_login_attempts_attempted_at ON login_attempts (attempted_at);
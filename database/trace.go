@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/burakiscoding/go-book-rent/database")
+
+func (d Dialect) system() attribute.KeyValue {
+	switch d {
+	case DialectPostgres:
+		return semconv.DBSystemPostgreSQL
+	case DialectSQLite:
+		return semconv.DBSystemSqlite
+	default:
+		return semconv.DBSystemMySQL
+	}
+}
+
+// startSpan starts a span of one statement, named after its operation (SELECT, UPDATE...).
+// Only the query text is recorded, never the arguments.
+func (d Dialect) startSpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	operation = strings.ToUpper(operation)
+
+	return tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(d.system(), semconv.DBOperationName(operation), semconv.DBQueryText(query)),
+	)
+}
+
+// endSpan marks the span failed unless err is nil or sql.ErrNoRows. No rows is a normal
+// outcome, it is recorded on the span without failing it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Row ends the span of its statement in Scan. The row is read there, and errors of
+// QueryRow, like sql.ErrNoRows, only show up there too.
+type Row struct {
+	*sql.Row
+	span  trace.Span
+	ended bool
+}
+
+func (r *Row) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+	if !r.ended {
+		r.ended = true
+		endSpan(r.span, err)
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// API keys look like "br_<prefix>_<secret>". The prefix is stored in plain text
+// so keys can be found and recognized, the whole key is only stored as a hash.
+const apiKeyMarker = "br"
+
+func GenerateAPIKey() (prefix string, key string, err error) {
+	prefixBytes := make([]byte, 4)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", err
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	key = apiKeyMarker + "_" + prefix + "_" + hex.EncodeToString(secretBytes)
+	return prefix, key, nil
+}
+
+func ParseAPIKeyPrefix(key string) (string, error) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != apiKeyMarker || parts[1] == "" || parts[2] == "" {
+		return "", BadCredentials()
+	}
+
+	return parts[1], nil
+}
+
+// Keys have 256 bits of entropy, so a fast hash is enough
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,279 @@
+package helpers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Error codes are part of the API, clients can rely on them. The detail text may change.
+const (
+	CodeInvalidJSON              = "invalid_json"
+	CodeInvalidRequest           = "invalid_request"
+	CodeInvalidRouteVariables    = "invalid_route_variables"
+	CodeValidationFailed         = "validation_failed"
+	CodeRequestTooLarge          = "request_too_large"
+	CodeUnauthorized             = "unauthorized"
+	CodeForbidden                = "forbidden"
+	CodeAccountSuspended         = "account_suspended"
+	CodeMFARequiredForAdmins     = "mfa_required_for_admins"
+	CodeReauthenticationRequired = "reauthentication_required"
+	CodeNotFound                 = "not_found"
+	CodeBookNotFound             = "book_not_found"
+	CodeUserNotFound             = "user_not_found"
+	CodeLoanNotFound             = "loan_not_found"
+	CodeRoleNotFound             = "role_not_found"
+	CodeSessionNotFound          = "session_not_found"
+	CodeAPIKeyNotFound           = "api_key_not_found"
+	CodeMethodNotAllowed         = "method_not_allowed"
+	CodeOutOfStock               = "out_of_stock"
+	CodeLoanAlreadyReturned      = "loan_already_returned"
+	CodeUsernameTaken            = "username_taken"
+	CodeOpenLoans                = "open_loans"
+	CodeCannotSuspendSelf        = "cannot_suspend_self"
+	CodeMFAAlreadyEnabled        = "mfa_already_enabled"
+	CodeMFANotEnabled            = "mfa_not_enabled"
+	CodeMFAEnrollmentNotStarted  = "mfa_enrollment_not_started"
+	CodeTooManyAttempts          = "too_many_attempts"
+	CodeInternal                 = "internal_error"
+	CodeCanceled                 = "request_canceled"
+	CodeTimeout                  = "timeout"
+)
+
+type errorCode struct {
+	status int
+	title  string
+}
+
+var errorCodes = map[string]errorCode{
+	CodeInvalidJSON:              {http.StatusBadRequest, "Invalid JSON"},
+	CodeInvalidRequest:           {http.StatusBadRequest, "Invalid request"},
+	CodeInvalidRouteVariables:    {http.StatusBadRequest, "Invalid route variables"},
+	CodeValidationFailed:         {http.StatusUnprocessableEntity, "Validation failed"},
+	CodeRequestTooLarge:          {http.StatusRequestEntityTooLarge, "Request body too large"},
+	CodeUnauthorized:             {http.StatusUnauthorized, "Bad credentials"},
+	CodeForbidden:                {http.StatusForbidden, "Forbidden"},
+	CodeAccountSuspended:         {http.StatusForbidden, "Account suspended"},
+	CodeMFARequiredForAdmins:     {http.StatusForbidden, "MFA is required for admins"},
+	CodeReauthenticationRequired: {http.StatusForbidden, "Reauthentication required"},
+	CodeNotFound:                 {http.StatusNotFound, "Not found"},
+	CodeBookNotFound:             {http.StatusNotFound, "Book not found"},
+	CodeUserNotFound:             {http.StatusNotFound, "User not found"},
+	CodeLoanNotFound:             {http.StatusNotFound, "Loan not found"},
+	CodeRoleNotFound:             {http.StatusNotFound, "Role not found"},
+	CodeSessionNotFound:          {http.StatusNotFound, "Session not found"},
+	CodeAPIKeyNotFound:           {http.StatusNotFound, "API key not found"},
+	CodeMethodNotAllowed:         {http.StatusMethodNotAllowed, "Method not allowed"},
+	CodeOutOfStock:               {http.StatusConflict, "Book out of stock"},
+	CodeLoanAlreadyReturned:      {http.StatusConflict, "Loan already returned"},
+	CodeUsernameTaken:            {http.StatusConflict, "Username taken"},
+	CodeOpenLoans:                {http.StatusConflict, "User has open loans"},
+	CodeCannotSuspendSelf:        {http.StatusConflict, "Can't suspend yourself"},
+	CodeMFAAlreadyEnabled:        {http.StatusConflict, "MFA already enabled"},
+	CodeMFANotEnabled:            {http.StatusConflict, "MFA not enabled"},
+	CodeMFAEnrollmentNotStarted:  {http.StatusConflict, "MFA enrollment not started"},
+	CodeTooManyAttempts:          {http.StatusTooManyRequests, "Too many attempts"},
+	CodeInternal:                 {http.StatusInternalServerError, "Internal server error"},
+	CodeCanceled:                 {http.StatusServiceUnavailable, "Request canceled"},
+	CodeTimeout:                  {http.StatusGatewayTimeout, "Request timed out"},
+}
+
+// ErrorCodes returns every error code, sorted
+func ErrorCodes() []string {
+	codes := make([]string, 0, len(errorCodes))
+	for code := range errorCodes {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// ProblemType is the RFC 7807 type of an error code. It identifies the code and is not meant to be fetched.
+func ProblemType(code string) string {
+	return "urn:book-rent:error:" + code
+}
+
+// APIError is the body of failed requests, an RFC 7807 problem.
+// code, request_id and errors are extension members.
+type APIError struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Message   string       `json:"detail"`
+	Code      string       `json:"code"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestId string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// NewAPIError creates an error with the status and title of the code. message is the detail of this occurrence.
+func NewAPIError(code, message string) APIError {
+	c, ok := errorCodes[code]
+	if !ok {
+		c = errorCodes[CodeInternal]
+	}
+	return APIError{Type: ProblemType(code), Title: c.title, Status: c.status, Message: message, Code: code}
+}
+
+func (e APIError) Error() string {
+	return fmt.Sprintf("api error: %s and status: %d", e.Detail(), e.Status)
+}
+
+// Is matches errors with the same code, e.g. errors.Is(err, BadCredentials()).
+// The field errors make APIError incomparable, so errors.Is needs this.
+func (e APIError) Is(target error) bool {
+	t, ok := target.(APIError)
+	return ok && t.Status == e.Status && t.Code == e.Code
+}
+
+// Detail is the message followed by the invalid fields, if any
+func (e APIError) Detail() string {
+	if len(e.Errors) == 0 {
+		return e.Message
+	}
+
+	fields := make([]string, len(e.Errors))
+	for i, f := range e.Errors {
+		fields[i] = f.Field + " " + f.Reason
+	}
+	return e.Message + ": " + strings.Join(fields, ", ")
+}
+
+func InvalidJSON() APIError {
+	return NewAPIError(CodeInvalidJSON, "invalid JSON request data")
+}
+
+func InvalidRequestData() APIError {
+	return NewAPIError(CodeInvalidRequest, "invalid request data")
+}
+
+// NotFoundData is returned for missing rows no handler expected and unknown paths
+func NotFoundData() APIError {
+	return NewAPIError(CodeNotFound, "data not found")
+}
+
+func InvalidRouteVariables() APIError {
+	return NewAPIError(CodeInvalidRouteVariables, "invalid route variables")
+}
+
+// BadCredentials is returned when the caller is not authenticated
+func BadCredentials() APIError {
+	return NewAPIError(CodeUnauthorized, "bad credentials")
+}
+
+// Forbidden is returned when the caller is authenticated but not allowed to do it
+func Forbidden() APIError {
+	return NewAPIError(CodeForbidden, "you don't have permission to do this")
+}
+
+// AccountSuspended is returned for the right credentials of a suspended user
+func AccountSuspended() APIError {
+	return NewAPIError(CodeAccountSuspended, "account is suspended")
+}
+
+func TooManyAttempts() APIError {
+	return NewAPIError(CodeTooManyAttempts, "too many attempts, try again later")
+}
+
+func BookNotFound() APIError {
+	return NewAPIError(CodeBookNotFound, "book not found")
+}
+
+func UserNotFound() APIError {
+	return NewAPIError(CodeUserNotFound, "user not found")
+}
+
+func LoanNotFound() APIError {
+	return NewAPIError(CodeLoanNotFound, "loan not found")
+}
+
+func RoleNotFound() APIError {
+	return NewAPIError(CodeRoleNotFound, "role not found")
+}
+
+func SessionNotFound() APIError {
+	return NewAPIError(CodeSessionNotFound, "session not found")
+}
+
+func APIKeyNotFound() APIError {
+	return NewAPIError(CodeAPIKeyNotFound, "api key not found")
+}
+
+func MethodNotAllowed() APIError {
+	return NewAPIError(CodeMethodNotAllowed, "method not allowed")
+}
+
+func OutOfStock() APIError {
+	return NewAPIError(CodeOutOfStock, "no copy of the book is left")
+}
+
+func LoanAlreadyReturned() APIError {
+	return NewAPIError(CodeLoanAlreadyReturned, "the book is already returned")
+}
+
+func UsernameTaken() APIError {
+	return NewAPIError(CodeUsernameTaken, "username is already taken")
+}
+
+func RequestTooLarge(limit int64) APIError {
+	return NewAPIError(CodeRequestTooLarge, fmt.Sprintf("request body is larger than %d bytes", limit))
+}
+
+// Timeout is returned when a query or the request ran out of time
+func Timeout() APIError {
+	return NewAPIError(CodeTimeout, "request timed out")
+}
+
+// Canceled is returned when the request was canceled, usually because the client went away
+func Canceled() APIError {
+	return NewAPIError(CodeCanceled, "request canceled")
+}
+
+// toAPIError maps errors that aren't APIErrors, anything unexpected is an internal error
+func toAPIError(err error) APIError {
+	var apiErr APIError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, sql.ErrNoRows):
+		return NotFoundData()
+	case errors.As(err, &maxBytesErr):
+		return RequestTooLarge(maxBytesErr.Limit)
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout()
+	case errors.Is(err, context.Canceled):
+		return Canceled()
+	default:
+		return NewAPIError(CodeInternal, "internal server error")
+	}
+}
+
+// WriteError writes err as an application/problem+json response with the request id
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := toAPIError(err)
+	problem.Instance = r.URL.Path
+	problem.RequestId = RequestId(r.Context())
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+
+	// The request span gets the error as an event, the router marks 5xx spans as failed
+	trace.SpanFromContext(r.Context()).RecordError(err)
+
+	// The access log already has the status, only failures of the server are errors
+	logger := Logger(r.Context())
+	if problem.Status < http.StatusInternalServerError {
+		logger.Debug("HTTP API error", "err", err.Error(), "code", problem.Code, "path", r.URL.Path)
+	} else {
+		logger.Error("HTTP API error", "err", err.Error(), "code", problem.Code, "path", r.URL.Path)
+	}
+}
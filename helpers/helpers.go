@@ -1,54 +1,21 @@
 package helpers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"log/slog"
+	"errors"
+	"net"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/burakiscoding/go-book-rent/types"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type APIFunc func(w http.ResponseWriter, r *http.Request) error
 
-type APIError struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
-}
-
-func NewAPIError(status int, message string) APIError {
-	return APIError{Status: status, Message: message}
-}
-
-func (e APIError) Error() string {
-	return fmt.Sprintf("api error: %s and status: %d", e.Message, e.Status)
-}
-
-func InvalidJSON() APIError {
-	return NewAPIError(http.StatusBadRequest, "invalid JSON request data")
-}
-
-func InvalidRequestData() APIError {
-	return NewAPIError(http.StatusBadRequest, "invalid request data")
-}
-
-func NotFoundData() APIError {
-	return NewAPIError(http.StatusNotFound, "data not found")
-}
-
-func InvalidRouteVariables() APIError {
-	return NewAPIError(http.StatusBadRequest, "invalid route variables")
-}
-
-func BadCredentials() APIError {
-	return NewAPIError(http.StatusUnauthorized, "bad credentials")
-}
-
 func WriteJSON(w http.ResponseWriter, status int, v any) error {
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -64,39 +31,106 @@ func WriteOK(w http.ResponseWriter) error {
 func MakeHandler(f APIFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := f(w, r); err != nil {
-			if apiErr, ok := err.(APIError); ok {
-				WriteJSON(w, apiErr.Status, apiErr)
-			} else {
-				errServer := NewAPIError(http.StatusInternalServerError, "internal server error")
-				WriteJSON(w, errServer.Status, errServer)
-			}
-			slog.Error("HTTP API error", "err", err.Error(), "path", r.URL.Path)
+			WriteError(w, r, err)
 		}
 	}
 }
 
+// SecurityEvent logs events that should be picked up by alerting
+func SecurityEvent(ctx context.Context, event string, args ...any) {
+	Logger(ctx).Warn("security event", append([]any{"event", event}, args...)...)
+}
+
+// ClientIP returns the address of the direct peer. Forwarded headers are not trusted.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	passwordsMu.RLock()
+	defer passwordsMu.RUnlock()
+
+	return passwordHasher.Hash(password)
 }
 
 func CheckHashedPassword(hashed, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
-	return err == nil
+	return verifyPassword(hashed, password)
+}
+
+const (
+	audienceNormal    = "normal"
+	audienceMFA       = "mfa"
+	audienceOIDCState = "oidc_state"
+)
+
+func signToken(claims jwt.MapClaims) (string, error) {
+	keys := Keys()
+	if keys == nil {
+		return "", errors.New("key manager is not set")
+	}
+
+	claims["iss"] = tokenIssuer
+	claims["iat"] = time.Now().Unix()
+	return keys.Sign(claims)
+}
+
+func parseToken(tokenString, audience string) (jwt.MapClaims, error) {
+	keys := Keys()
+	if keys == nil {
+		return nil, errors.New("key manager is not set")
+	}
+
+	token, err := keys.Parse(tokenString, audience)
+	if err != nil {
+		return nil, BadCredentials()
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, BadCredentials()
+	}
+
+	return claims, nil
 }
 
-func CreateJWT(id, role string) (string, error) {
-	secret := []byte(os.Getenv("JWT_SECRET"))
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// CreateJWT creates an access token. The session id ("sid") lets a sign-out revoke it early.
+func CreateJWT(id, role, sessionId string) (string, error) {
+	return signToken(jwt.MapClaims{
 		"sub":  id,
 		"role": role,
-		"iss":  "book-rent",
-		"aud":  "normal",
+		"sid":  sessionId,
+		"aud":  audienceNormal,
 		"exp":  time.Now().Add(time.Minute * 15).Unix(),
-		"iat":  time.Now().Unix(),
 	})
+}
+
+// CreateMFAToken is returned by login when the second factor is still missing.
+// It can't be used as a normal token.
+func CreateMFAToken(id string) (string, error) {
+	return signToken(jwt.MapClaims{
+		"sub": id,
+		"aud": audienceMFA,
+		"exp": time.Now().Add(time.Minute * 5).Unix(),
+	})
+}
+
+func GetMFATokenUserId(tokenString string) (string, error) {
+	claims, err := parseToken(tokenString, audienceMFA)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := claims.GetSubject()
+	if err != nil || id == "" {
+		return "", BadCredentials()
+	}
 
-	return claims.SignedString(secret)
+	return id, nil
 }
 
 func GetTokenFromHeader(r *http.Request) (string, error) {
@@ -114,25 +148,47 @@ func GetTokenFromHeader(r *http.Request) (string, error) {
 	return token, nil
 }
 
-func GetTokenPayload(tokenString string) (types.TokenPayload, error) {
-	secret := []byte(os.Getenv("JWT_SECRET"))
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		return secret, nil
+// CreateOIDCStateToken keeps the values of one OIDC login in a cookie between redirects
+func CreateOIDCStateToken(state, nonce, verifier string) (string, error) {
+	return signToken(jwt.MapClaims{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"aud":      audienceOIDCState,
+		"exp":      time.Now().Add(time.Minute * 10).Unix(),
 	})
+}
+
+func GetOIDCState(tokenString string) (state, nonce, verifier string, err error) {
+	claims, err := parseToken(tokenString, audienceOIDCState)
 	if err != nil {
-		return types.TokenPayload{}, BadCredentials()
+		return "", "", "", err
 	}
 
-	if !token.Valid {
-		return types.TokenPayload{}, BadCredentials()
+	state, _ = claims["state"].(string)
+	nonce, _ = claims["nonce"].(string)
+	verifier, _ = claims["verifier"].(string)
+	if state == "" || verifier == "" {
+		return "", "", "", BadCredentials()
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
+	return state, nonce, verifier, nil
+}
+
+func GetTokenPayload(tokenString string) (types.TokenPayload, error) {
+	claims, err := parseToken(tokenString, audienceNormal)
+	if err != nil {
+		return types.TokenPayload{}, err
+	}
+
+	id, _ := claims["sub"].(string)
+	role, _ := claims["role"].(string)
+	sessionId, _ := claims["sid"].(string)
+	if id == "" || role == "" {
 		return types.TokenPayload{}, BadCredentials()
 	}
 
-	return types.TokenPayload{Id: claims["sub"].(string), Role: claims["role"].(string)}, nil
+	return types.TokenPayload{Id: id, Role: role, SessionId: sessionId}, nil
 }
 
 func GetTokenPayloadFromContext(r *http.Request) (types.TokenPayload, error) {
@@ -143,5 +199,13 @@ func GetTokenPayloadFromContext(r *http.Request) (types.TokenPayload, error) {
 		return types.TokenPayload{}, BadCredentials()
 	}
 
-	return types.TokenPayload{Id: id, Role: role}, nil
+	permissions, _ := r.Context().Value(types.KeyPermissions).([]string)
+	sessionId, _ := r.Context().Value(types.KeySessionId).(string)
+
+	return types.TokenPayload{Id: id, Role: role, SessionId: sessionId, Permissions: permissions}, nil
+}
+
+func HasPermission(r *http.Request, permission string) bool {
+	permissions, _ := r.Context().Value(types.KeyPermissions).([]string)
+	return slices.Contains(permissions, permission)
 }
@@ -0,0 +1,309 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const tokenIssuer = "book-rent"
+
+type jwtKey struct {
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// KeyManager signs tokens with the active key and verifies them with any known key.
+// Keys are selected by the "kid" header, so old keys can keep verifying during rotation.
+type KeyManager struct {
+	mu         sync.RWMutex
+	keys       map[string]jwtKey
+	signingKid string
+}
+
+func NewKeyManager() *KeyManager {
+	return &KeyManager{keys: make(map[string]jwtKey)}
+}
+
+// AddHMACKey adds a shared secret (HS256). It is never published in the JWKS.
+func (m *KeyManager) AddHMACKey(kid string, secret []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[kid] = jwtKey{method: jwt.SigningMethodHS256, private: secret, public: secret}
+}
+
+// AddPrivateKey adds an RSA (RS256) or Ed25519 (EdDSA) key that can sign and verify
+func (m *KeyManager) AddPrivateKey(kid string, key crypto.PrivateKey) error {
+	var k jwtKey
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		k = jwtKey{method: jwt.SigningMethodRS256, private: key, public: &key.PublicKey}
+	case ed25519.PrivateKey:
+		k = jwtKey{method: jwt.SigningMethodEdDSA, private: key, public: key.Public()}
+	default:
+		return fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[kid] = k
+
+	return nil
+}
+
+// AddPublicKey adds a verification-only key, e.g. a retired signing key
+func (m *KeyManager) AddPublicKey(kid string, key crypto.PublicKey) error {
+	var k jwtKey
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		k = jwtKey{method: jwt.SigningMethodRS256, public: key}
+	case ed25519.PublicKey:
+		k = jwtKey{method: jwt.SigningMethodEdDSA, public: key}
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[kid] = k
+
+	return nil
+}
+
+func (m *KeyManager) SetSigningKey(kid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ok := m.keys[kid]
+	if !ok || k.private == nil {
+		return fmt.Errorf("no private key with id %q", kid)
+	}
+	m.signingKid = kid
+
+	return nil
+}
+
+func (m *KeyManager) Sign(claims jwt.MapClaims) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	k, ok := m.keys[m.signingKid]
+	if !ok {
+		return "", errors.New("no signing key")
+	}
+
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = m.signingKid
+	return token.SignedString(k.private)
+}
+
+// Parse verifies the signature with the key named by "kid" and only accepts that key's algorithm.
+// Issuer, audience and expiry are always required.
+func (m *KeyManager) Parse(tokenString, audience string) (*jwt.Token, error) {
+	var alg string
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+
+		k, ok := m.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if t.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		alg = k.method.Alg()
+
+		return k.public, nil
+	}
+
+	token, err := jwt.Parse(tokenString, keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || alg == "" {
+		return nil, errors.New("invalid token")
+	}
+
+	return token, nil
+}
+
+type JWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys, so other services can verify tokens without a shared secret
+func (m *KeyManager) JWKS() JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for kid, k := range m.keys {
+		switch public := k.public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kid: kid,
+				Kty: "RSA",
+				Alg: k.method.Alg(),
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kid: kid,
+				Kty: "OKP",
+				Alg: k.method.Alg(),
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// LoadKeyManagerFromDir loads every *.pem file in dir. The file name is the key id.
+// Private keys can sign and verify, public keys only verify.
+// The active key is activeKid, or the last private key by name if it is empty.
+func LoadKeyManagerFromDir(dir, activeKid string) (*KeyManager, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	m := NewKeyManager()
+	lastPrivate := ""
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+
+		bytes, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		block, _ := pem.Decode(bytes)
+		if block == nil {
+			return nil, fmt.Errorf("%s: no PEM data", file)
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if err := m.AddPrivateKey(kid, key); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			lastPrivate = kid
+		case "RSA PRIVATE KEY":
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if err := m.AddPrivateKey(kid, key); err != nil {
+				return nil, err
+			}
+			lastPrivate = kid
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if err := m.AddPublicKey(kid, key); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s: unsupported PEM type %s", file, block.Type)
+		}
+	}
+
+	if activeKid == "" {
+		activeKid = lastPrivate
+	}
+
+	if err := m.SetSigningKey(activeKid); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+var (
+	keysMu      sync.RWMutex
+	defaultKeys *KeyManager
+)
+
+// SetKeyManager sets the keys used by CreateJWT and GetTokenPayload
+func SetKeyManager(m *KeyManager) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	defaultKeys = m
+}
+
+func Keys() *KeyManager {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	return defaultKeys
+}
+
+// LoadKeyManager reads the keys at startup and on reload. A keys directory enables
+// asymmetric keys, otherwise the secret is used as an HS256 secret.
+func LoadKeyManager(secret, keysDir, activeKid string) (*KeyManager, error) {
+	if keysDir != "" {
+		return LoadKeyManagerFromDir(keysDir, activeKid)
+	}
+
+	if secret == "" {
+		return nil, errors.New("a JWT keys directory or secret must be set")
+	}
+
+	m := NewKeyManager()
+	m.AddHMACKey("hs256", []byte(secret))
+	if err := m.SetSigningKey("hs256"); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,67 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+// NewLogger builds a logger writing "text" or "json" lines at the given level
+func NewLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	options := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+}
+
+// Logger returns the logger of the request, which carries its request id and user id.
+// Outside of a request it is the default logger.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(types.KeyLogger).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, types.KeyLogger, logger)
+}
+
+// RequestId returns the X-Request-ID of the request, empty outside of one
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(types.KeyRequestId).(string)
+	return id
+}
+
+// AccessLog collects what handlers learn about a request for its access log line
+type AccessLog struct {
+	UserId string
+}
+
+func WithAccessLog(ctx context.Context, entry *AccessLog) context.Context {
+	return context.WithValue(ctx, types.KeyAccessLog, entry)
+}
+
+// WithLogUser adds the authenticated user to the request logger and the access log
+func WithLogUser(ctx context.Context, userId string) context.Context {
+	if entry, ok := ctx.Value(types.KeyAccessLog).(*AccessLog); ok {
+		entry.UserId = userId
+	}
+
+	return WithLogger(ctx, Logger(ctx).With("user_id", userId))
+}
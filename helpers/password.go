@@ -0,0 +1,267 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher creates self-describing hashes, so a stored hash tells which
+// algorithm and parameters were used for it
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// NeedsRehash reports whether the hash was made with another algorithm or parameters
+	NeedsRehash(hash string) bool
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+// bcrypt only uses the first 72 bytes of a password and refuses to hash longer ones
+const bcryptMaxBytes = 72
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(bytes), err
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher stores hashes in the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// OWASP recommended minimum
+func DefaultArgon2idHasher() Argon2idHasher {
+	return Argon2idHasher{Memory: 19 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != h.Memory || params.Iterations != h.Iterations || params.Parallelism != h.Parallelism ||
+		uint32(len(salt)) != h.SaltLength || uint32(len(key)) != h.KeyLength
+}
+
+func decodeArgon2id(hash string) (Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idHasher{}, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idHasher{}, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	var params Argon2idHasher
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idHasher{}, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, err
+	}
+
+	return params, salt, key, nil
+}
+
+// verifyPassword works for every supported format, whatever hasher is configured
+func verifyPassword(hash, password string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NewPasswordHasher returns the hasher of an algorithm, argon2id or bcrypt.
+// Parameters are validated by the config package.
+func NewPasswordHasher(algorithm string, argon Argon2idHasher, bcryptCost int) (PasswordHasher, error) {
+	switch algorithm {
+	case "", "argon2id":
+		return argon, nil
+	case "bcrypt":
+		return BcryptHasher{Cost: bcryptCost}, nil
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm: %s", algorithm)
+	}
+}
+
+// PasswordPolicy rejects short passwords and passwords from a breached list
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes limits the UTF-8 length, zero means no limit. CheckPasswordPolicy sets it for bcrypt.
+	MaxBytes int
+	// SHA-1 hashes (upper case hex) of breached passwords
+	breached map[string]struct{}
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 8, MaxLength: 128}
+}
+
+// LoadBreachedList reads one password or SHA-1 hash (like the Have I Been Pwned dumps) per line.
+// Anything after a colon is ignored, so "HASH:COUNT" lines work as they are.
+func (p *PasswordPolicy) LoadBreachedList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	p.breached = make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			p.breached[strings.ToUpper(hash)] = struct{}{}
+		} else {
+			p.breached[sha1Hex(line)] = struct{}{}
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (p PasswordPolicy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return ValidationFailed(FieldError{Field: "password", Reason: fmt.Sprintf("must be at least %d characters", p.MinLength)})
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return ValidationFailed(FieldError{Field: "password", Reason: fmt.Sprintf("must be at most %d characters", p.MaxLength)})
+	}
+
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		return ValidationFailed(FieldError{Field: "password", Reason: fmt.Sprintf("must be at most %d bytes", p.MaxBytes)})
+	}
+
+	if _, found := p.breached[sha1Hex(password)]; found {
+		return ValidationFailed(FieldError{Field: "password", Reason: "appears in a list of breached passwords"})
+	}
+
+	return nil
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// NewPasswordPolicy returns the policy with an optional breached list file
+func NewPasswordPolicy(minLength int, breachedListFile string) (PasswordPolicy, error) {
+	policy := DefaultPasswordPolicy()
+	policy.MinLength = minLength
+
+	if breachedListFile != "" {
+		if err := policy.LoadBreachedList(breachedListFile); err != nil {
+			return PasswordPolicy{}, err
+		}
+	}
+
+	return policy, nil
+}
+
+var (
+	passwordsMu    sync.RWMutex
+	passwordHasher PasswordHasher = DefaultArgon2idHasher()
+	passwordPolicy                = DefaultPasswordPolicy()
+)
+
+func SetPasswordHasher(h PasswordHasher) {
+	passwordsMu.Lock()
+	defer passwordsMu.Unlock()
+
+	passwordHasher = h
+}
+
+func SetPasswordPolicy(p PasswordPolicy) {
+	passwordsMu.Lock()
+	defer passwordsMu.Unlock()
+
+	passwordPolicy = p
+}
+
+// CheckPasswordPolicy checks the policy and the limits of the current hasher
+func CheckPasswordPolicy(password string) error {
+	passwordsMu.RLock()
+	defer passwordsMu.RUnlock()
+
+	policy := passwordPolicy
+	if _, ok := passwordHasher.(BcryptHasher); ok && (policy.MaxBytes == 0 || policy.MaxBytes > bcryptMaxBytes) {
+		policy.MaxBytes = bcryptMaxBytes
+	}
+
+	return policy.Check(password)
+}
+
+func PasswordNeedsRehash(hash string) bool {
+	passwordsMu.RLock()
+	defer passwordsMu.RUnlock()
+
+	return passwordHasher.NeedsRehash(hash)
+}
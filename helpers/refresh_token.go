@@ -0,0 +1,33 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Refresh tokens look like "<session id>.<secret>". Only a hash is stored with the session.
+func GenerateRefreshToken(sessionId string) (token string, hash string, err error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+
+	token = sessionId + "." + hex.EncodeToString(bytes)
+	return token, HashRefreshToken(token), nil
+}
+
+func ParseRefreshToken(token string) (sessionId string, err error) {
+	sessionId, secret, found := strings.Cut(token, ".")
+	if !found || sessionId == "" || secret == "" {
+		return "", BadCredentials()
+	}
+
+	return sessionId, nil
+}
+
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
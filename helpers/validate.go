@@ -0,0 +1,278 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/google/uuid"
+)
+
+// FieldError is one invalid field of a request
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationFailed lists every invalid field of a request
+func ValidationFailed(errs ...FieldError) APIError {
+	apiErr := NewAPIError(CodeValidationFailed, "validation failed")
+	apiErr.Errors = errs
+	return apiErr
+}
+
+type validationPattern struct {
+	re     *regexp.Regexp
+	reason string
+}
+
+// Patterns of the pattern rule by name, regular expressions can't be written in tags because of the commas
+var validationPatterns = map[string]validationPattern{
+	"username": {regexp.MustCompile(`^[A-Za-z0-9._@+-]+$`), "may only contain letters, digits and . _ @ + -"},
+}
+
+// DecodeJSON decodes a single JSON object into v. Unknown fields and data after the object are rejected,
+// values of the wrong type are reported as field errors.
+func DecodeJSON(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return RequestTooLarge(maxBytesErr.Limit)
+		}
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return ValidationFailed(FieldError{Field: typeErr.Field, Reason: "must be " + jsonKind(typeErr.Type)})
+		}
+		if strings.HasPrefix(err.Error(), "json: unknown field ") {
+			return NewAPIError(CodeInvalidJSON, "invalid JSON request data: "+strings.TrimPrefix(err.Error(), "json: "))
+		}
+		return InvalidJSON()
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return NewAPIError(CodeInvalidJSON, "invalid JSON request data: unexpected data after the object")
+	}
+
+	return nil
+}
+
+// DecodeRequest decodes the body with DecodeJSON and checks it with Validate
+func DecodeRequest(r *http.Request, v any) error {
+	if err := DecodeJSON(r, v); err != nil {
+		return err
+	}
+	return Validate(v)
+}
+
+// Validate checks the validate tags of a struct and returns ValidationFailed with every invalid field.
+// extra are errors the caller found itself, e.g. against the config, they are reported together.
+//
+//	required      not empty, blank strings count as empty
+//	min=N, max=N  length of strings and slices, value of numbers
+//	pattern=name  matches one of validationPatterns
+//	email, isbn, uuid, permission
+//
+// Rules other than required skip empty strings, so optional fields are only checked when set.
+// The format rules apply to every item of a slice.
+func Validate(v any, extra ...FieldError) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: %T is not a struct", v)
+	}
+
+	var errs []FieldError
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		for _, rule := range strings.Split(tag, ",") {
+			fieldErrs, err := checkRule(name, rule, value.Field(i))
+			if err != nil {
+				return fmt.Errorf("validate: %s.%s: %w", t, field.Name, err)
+			}
+			errs = append(errs, fieldErrs...)
+			// One reason per field is enough
+			if len(fieldErrs) > 0 {
+				break
+			}
+		}
+	}
+
+	errs = append(errs, extra...)
+	if len(errs) > 0 {
+		return ValidationFailed(errs...)
+	}
+	return nil
+}
+
+func checkRule(name, rule string, value reflect.Value) ([]FieldError, error) {
+	rule, arg, _ := strings.Cut(rule, "=")
+	fail := func(reason string) []FieldError {
+		return []FieldError{{Field: name, Reason: reason}}
+	}
+
+	switch rule {
+	case "required":
+		if value.IsZero() || (value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "") ||
+			(value.Kind() == reflect.Slice && value.Len() == 0) {
+			return fail("is required"), nil
+		}
+		return nil, nil
+
+	case "min", "max":
+		limit, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s rule %q", rule, arg)
+		}
+		var n int
+		var unit string
+		switch value.Kind() {
+		case reflect.String:
+			if value.Len() == 0 {
+				return nil, nil
+			}
+			n, unit = utf8.RuneCountInString(value.String()), " characters"
+		case reflect.Slice:
+			n, unit = value.Len(), " items"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = int(value.Int())
+		default:
+			return nil, fmt.Errorf("%s rule on a %s", rule, value.Kind())
+		}
+		if rule == "min" && n < limit {
+			return fail(fmt.Sprintf("must be at least %d%s", limit, unit)), nil
+		}
+		if rule == "max" && n > limit {
+			return fail(fmt.Sprintf("must be at most %d%s", limit, unit)), nil
+		}
+		return nil, nil
+	}
+
+	var check func(string) bool
+	var reason string
+	switch rule {
+	case "pattern":
+		pattern, ok := validationPatterns[arg]
+		if !ok {
+			return nil, fmt.Errorf("unknown pattern %q", arg)
+		}
+		check, reason = pattern.re.MatchString, pattern.reason
+	case "email":
+		check, reason = isEmail, "must be an email address"
+	case "isbn":
+		check, reason = isISBN, "must be an ISBN-10 or ISBN-13"
+	case "uuid":
+		check = func(s string) bool {
+			_, err := uuid.Parse(s)
+			return err == nil
+		}
+		reason = "must be a UUID"
+	case "permission":
+		check = func(s string) bool {
+			return slices.Contains(types.AllPermissions, s)
+		}
+		reason = "must be one of " + strings.Join(types.AllPermissions, ", ")
+	default:
+		return nil, fmt.Errorf("unknown rule %q", rule)
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		if value.Len() > 0 && !check(value.String()) {
+			return fail(reason), nil
+		}
+		return nil, nil
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			break
+		}
+		var errs []FieldError
+		for i := 0; i < value.Len(); i++ {
+			if !check(value.Index(i).String()) {
+				errs = append(errs, FieldError{Field: fmt.Sprintf("%s[%d]", name, i), Reason: reason})
+			}
+		}
+		return errs, nil
+	}
+	return nil, fmt.Errorf("%s rule on a %s", rule, value.Kind())
+}
+
+func isEmail(s string) bool {
+	address, err := mail.ParseAddress(s)
+	return err == nil && address.Address == s
+}
+
+// isISBN checks the check digit of ISBN-10 and ISBN-13 numbers, hyphens and spaces are ignored
+func isISBN(s string) bool {
+	s = strings.NewReplacer("-", "", " ", "").Replace(s)
+
+	switch len(s) {
+	case 10:
+		sum := 0
+		for i, c := range s {
+			digit := int(c - '0')
+			if i == 9 && (c == 'X' || c == 'x') {
+				digit = 10
+			} else if c < '0' || c > '9' {
+				return false
+			}
+			sum += (10 - i) * digit
+		}
+		return sum%11 == 0
+	case 13:
+		sum := 0
+		for i, c := range s {
+			if c < '0' || c > '9' {
+				return false
+			}
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += weight * int(c-'0')
+		}
+		return sum%10 == 0
+	}
+	return false
+}
+
+// jsonKind names the JSON type a Go type decodes from
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
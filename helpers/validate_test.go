@@ -0,0 +1,93 @@
+package helpers
+
+import (
+	"errors"
+	"testing"
+)
+
+type formatRequest struct {
+	Email string   `json:"email" validate:"email"`
+	ISBN  string   `json:"isbn" validate:"isbn"`
+	ISBNs []string `json:"isbns" validate:"isbn"`
+}
+
+// fieldErrors returns the field errors of a validation failure, nil if v is valid
+func fieldErrors(t *testing.T, v any) []FieldError {
+	t.Helper()
+
+	err := Validate(v)
+	if err == nil {
+		return nil
+	}
+
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeValidationFailed {
+		t.Fatalf("got %v, expected a validation failure", err)
+	}
+	return apiErr.Errors
+}
+
+func TestEmailRule(t *testing.T) {
+	tests := []struct {
+		email string
+		valid bool
+	}{
+		{"alice@example.com", true},
+		{"alice.smith+books@mail.example.org", true},
+		{"", true}, // optional, only required rejects empty values
+		{"alice", false},
+		{"alice@", false},
+		{"@example.com", false},
+		{"Alice <alice@example.com>", false},
+		{" alice@example.com", false},
+	}
+
+	for _, test := range tests {
+		errs := fieldErrors(t, formatRequest{Email: test.email})
+		if valid := len(errs) == 0; valid != test.valid {
+			t.Errorf("email %q: got errors %v, expected valid %v", test.email, errs, test.valid)
+		}
+		if !test.valid && len(errs) == 1 && errs[0] != (FieldError{Field: "email", Reason: "must be an email address"}) {
+			t.Errorf("email %q: got %v", test.email, errs[0])
+		}
+	}
+}
+
+func TestISBNRule(t *testing.T) {
+	tests := []struct {
+		isbn  string
+		valid bool
+	}{
+		{"0306406152", true},
+		{"0-306-40615-2", true},
+		{"080442957X", true},
+		{"080442957x", true},
+		{"9780306406157", true},
+		{"978-0-306-40615-7", true},
+		{"978 0 306 40615 7", true},
+		{"0306406153", false},    // wrong check digit
+		{"9780306406158", false}, // wrong check digit
+		{"X804429570", false},    // X only as the last digit of ISBN-10
+		{"978030640615X", false}, // no X in ISBN-13
+		{"030640615", false},
+		{"97803064061577", false},
+		{"abcdefghij", false},
+	}
+
+	for _, test := range tests {
+		errs := fieldErrors(t, formatRequest{ISBN: test.isbn})
+		if valid := len(errs) == 0; valid != test.valid {
+			t.Errorf("isbn %q: got errors %v, expected valid %v", test.isbn, errs, test.valid)
+		}
+		if !test.valid && len(errs) == 1 && errs[0] != (FieldError{Field: "isbn", Reason: "must be an ISBN-10 or ISBN-13"}) {
+			t.Errorf("isbn %q: got %v", test.isbn, errs[0])
+		}
+	}
+}
+
+func TestFormatRulesCheckEveryItem(t *testing.T) {
+	errs := fieldErrors(t, formatRequest{ISBNs: []string{"0306406152", "0306406153"}})
+	if len(errs) != 1 || errs[0].Field != "isbns[1]" {
+		t.Fatalf("got %v, expected an error for isbns[1]", errs)
+	}
+}
@@ -1,59 +1,317 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
-
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/burakiscoding/go-book-rent/api"
+	"github.com/burakiscoding/go-book-rent/cli"
+	"github.com/burakiscoding/go-book-rent/config"
 	"github.com/burakiscoding/go-book-rent/database"
 	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/metrics"
+	"github.com/burakiscoding/go-book-rent/oidc"
+	"github.com/burakiscoding/go-book-rent/server"
 	"github.com/burakiscoding/go-book-rent/store"
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
+	"github.com/burakiscoding/go-book-rent/tracing"
 )
 
 func main() {
-	err := godotenv.Load()
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(args) > 0 && args[0] == "keys" {
+		if err := cli.RunKeys(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "config" {
+		if err := cli.RunConfig(args[1:], cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "openapi" {
+		if err := cli.RunOpenAPI(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// The database is only opened when a command doesn't use the API
+	if len(args) > 0 && cli.IsOpsCommand(args[0]) {
+		err := cli.RunOps(args, func() (store.Stores, error) {
+			if cfg.Store != "sql" {
+				return store.Stores{}, fmt.Errorf("%s needs --store=sql or -api-url", args[0])
+			}
+			if err := cfg.ValidateOps(); err != nil {
+				return store.Stores{}, fmt.Errorf("invalid config:\n%w", err)
+			}
+			stores, _, err := openStores(cfg)
+			return stores, err
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(args) > 0 && (args[0] == "migrate" || args[0] == "admin") {
+		if err := runDatabaseCommand(cfg, args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid config:\n%v", err)
+	}
+
+	logger, err := cfg.Log.Logger(os.Stderr)
 	if err != nil {
 		log.Fatal(err)
 	}
+	// Also routes the log package through the logger
+	slog.SetDefault(logger)
 
-	db, err := database.NewSQL()
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Tracing())
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err := db.Ping(); err != nil {
+	keys, err := helpers.LoadKeyManager(cfg.Auth.JWTSecret, cfg.Auth.JWTKeysDir, cfg.Auth.JWTActiveKeyId)
+	if err != nil {
+		log.Fatal(err)
+	}
+	helpers.SetKeyManager(keys)
+
+	hasher, err := cfg.Password.PasswordHasher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	helpers.SetPasswordHasher(hasher)
+
+	policy, err := helpers.NewPasswordPolicy(cfg.Password.MinLength, cfg.Password.BreachedListFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	helpers.SetPasswordPolicy(policy)
+
+	stores, db, err := openStores(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	routerConfig := api.RouterConfig{
+		RequireAdminMFA: cfg.Auth.RequireAdminMFA,
+		Rental:          api.RentalPolicy{MinDays: cfg.Rental.MinDays, MaxDays: cfg.Rental.MaxDays},
+		LoginWindow:     cfg.Auth.LoginWindow,
+		LockoutAfter:    cfg.Auth.LockoutAfter,
+		LockoutDuration: cfg.Auth.LockoutDuration,
+	}
+
+	// Optional one-time token for creating the initial admin through the API
+	if cfg.Auth.SetupTokenEnabled {
+		setupHandler := api.NewSetupHandler(stores.Users)
+		token, err := setupHandler.GenerateToken(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if token != "" {
+			// Straight to stderr, not through the logger: the token has to be shown whatever
+			// the log level is, and a secret doesn't belong in shipped logs
+			fmt.Fprintf(os.Stderr, "no admin found, setup token: %s\n", token)
+			routerConfig.SetupHandler = setupHandler
+		}
+	}
+
+	// Optional single sign-on through an OpenID Connect provider
+	if cfg.Auth.OIDC.Issuer != "" {
+		provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+			Issuer:       cfg.Auth.OIDC.Issuer,
+			ClientId:     cfg.Auth.OIDC.ClientId,
+			ClientSecret: cfg.Auth.OIDC.ClientSecret,
+			RedirectURL:  cfg.Auth.OIDC.RedirectURL,
+		}, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		routerConfig.OIDCProvider = provider
+	}
+
+	health := api.NewHealthHandler(cfg.HTTP.HealthTimeout)
+	routerConfig.Health = health
+	routerConfig.Logger = logger
+	if db != nil {
+		health.AddCheck("database", true, db.PingContext)
+		health.AddCheck("migrations", true, db.CheckMigrations)
+
+		if err := metrics.RegisterDB(db.DB, cfg.Database.Name); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := metrics.RegisterInventory(stores.Books, stores.Rent, cfg.Metrics.ScrapeTimeout); err != nil {
+		log.Fatal(err)
+	}
+
+	router := api.NewRouter(stores, routerConfig)
+	srv, err := server.New(cfg.HTTP.Server(), router)
+	if err != nil {
 		log.Fatal(err)
 	}
+	srv.OnDrain(health.SetDraining)
+	if cfg.HTTP.TLSCertFile != "" {
+		health.AddCheck("tls_certificate", false, srv.CertificateStatus)
+	}
+
+	// Reload keys and TLS certificates on SIGHUP so they can be rotated without a restart
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	hupDone := make(chan struct{})
+	go func() {
+		defer close(hupDone)
+		for range hup {
+			keys, err := helpers.LoadKeyManager(cfg.Auth.JWTSecret, cfg.Auth.JWTKeysDir, cfg.Auth.JWTActiveKeyId)
+			if err != nil {
+				log.Println(err)
+			} else {
+				helpers.SetKeyManager(keys)
+			}
+
+			if err := srv.ReloadCertificates(); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+	srv.OnShutdown("reload signal handler", func(ctx context.Context) error {
+		signal.Stop(hup)
+		close(hup)
+		<-hupDone
+		return nil
+	})
+
+	if cfg.Metrics.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		metricsSrv, err := server.New(cfg.MetricsServer(), mux)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		metricsCtx, stopMetrics := context.WithCancel(context.Background())
+		metricsDone := make(chan struct{})
+		go func() {
+			defer close(metricsDone)
+			if err := metricsSrv.Run(metricsCtx); err != nil {
+				log.Fatal(err)
+			}
+		}()
+		srv.OnShutdown("metrics server", func(ctx context.Context) error {
+			stopMetrics()
+			<-metricsDone
+			return nil
+		})
+	}
+
+	// The database is closed last, after in-flight requests finished their transactions
+	if db != nil {
+		srv.OnShutdown("database", func(ctx context.Context) error {
+			return db.Close()
+		})
+	}
 
-	router := mux.NewRouter()
-	subrouter := router.PathPrefix("/api/v1").Subrouter()
+	// Flushes the spans of the last requests
+	srv.OnShutdown("tracing", shutdownTracing)
 
-	bookStore := store.NewBookStore(db)
-	bookHandler := api.NewBookHandler(*bookStore)
-	subrouter.HandleFunc("/books", helpers.MakeHandler(bookHandler.HandleGetAll)).Methods(http.MethodGet)
-	subrouter.HandleFunc("/books/{id}", helpers.MakeHandler(bookHandler.HandleGetById)).Methods(http.MethodGet)
-	subrouter.HandleFunc("/books", helpers.MakeHandler(api.HandleAdminAuth(bookHandler.HandleInsert))).Methods(http.MethodPost)
-	subrouter.HandleFunc("/books/{id}", helpers.MakeHandler(api.HandleAdminAuth(bookHandler.HandleUpdate))).Methods(http.MethodPut)
-	subrouter.HandleFunc("/books/{id}", helpers.MakeHandler(api.HandleAdminAuth(bookHandler.HandleDelete))).Methods(http.MethodDelete)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	userStore := store.NewUserStore(db)
-	userHandler := api.NewUserHandler(*userStore)
-	subrouter.HandleFunc("/user/register", helpers.MakeHandler(userHandler.HandleRegister)).Methods(http.MethodPost)
-	subrouter.HandleFunc("/user/login", helpers.MakeHandler(userHandler.HandleLogin)).Methods(http.MethodPost)
-	subrouter.HandleFunc("/user/details", helpers.MakeHandler(api.HandleAuth(userHandler.HandleGetDetails))).Methods(http.MethodPost)
-	subrouter.HandleFunc("/user/admin-register", helpers.MakeHandler(userHandler.HandleAdminRegister)).
-		Host("localhost").Methods(http.MethodPost)
+	if err := srv.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runDatabaseCommand runs migrate and admin on the SQL database. They don't serve the API,
+// so they only need the database and password settings, not a JWT secret.
+func runDatabaseCommand(cfg config.Config, args []string) error {
+	if cfg.Store != "sql" {
+		return fmt.Errorf("%s needs --store=sql", args[0])
+	}
+	if err := cfg.ValidateOps(); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
 
-	rentStore := store.NewRentStore(db)
-	rentHandler := api.NewRentHandler(*rentStore, *bookStore)
-	subrouter.HandleFunc("/rent/book", helpers.MakeHandler(api.HandleAuth(rentHandler.HandleRentBook))).Methods(http.MethodPost)
-	subrouter.HandleFunc("/rent/history", helpers.MakeHandler(api.HandleAdminAuth(rentHandler.HandleGetAllHistory))).Methods(http.MethodGet)
-	subrouter.HandleFunc("/rent/return", helpers.MakeHandler(api.HandleAuth(rentHandler.HandleReturnBook))).Methods(http.MethodPost)
-	subrouter.HandleFunc("/rent/user-history", helpers.MakeHandler(api.HandleAuth(rentHandler.HandleGetUserHistory))).Methods(http.MethodGet)
+	// Admins are created with the hasher and policy of the server
+	hasher, err := cfg.Password.PasswordHasher()
+	if err != nil {
+		return err
+	}
+	helpers.SetPasswordHasher(hasher)
+
+	policy, err := helpers.NewPasswordPolicy(cfg.Password.MinLength, cfg.Password.BreachedListFile)
+	if err != nil {
+		return err
+	}
+	helpers.SetPasswordPolicy(policy)
+
+	stores, db, err := openStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if args[0] == "migrate" {
+		return cli.RunMigrate(args[1:], db)
+	}
+	return cli.RunAdmin(args[1:], stores.Users)
+}
+
+// openStores connects to the configured store. db is nil for the memory store.
+func openStores(cfg config.Config) (store.Stores, *database.DB, error) {
+	if cfg.Store == "memory" {
+		return store.NewMemoryStores(), nil, nil
+	}
+
+	dbConfig, err := cfg.Database.SQL()
+	if err != nil {
+		return store.Stores{}, nil, err
+	}
+
+	db, err := database.NewSQLWithConfig(dbConfig)
+	if err != nil {
+		return store.Stores{}, nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return store.Stores{}, nil, err
+	}
+
+	// Optional, replicas wait for each other on a database lock
+	if cfg.Database.AutoMigrate {
+		applied, err := db.MigrateUp(context.Background())
+		if err != nil {
+			return store.Stores{}, nil, err
+		}
+		for _, m := range applied {
+			log.Printf("applied migration %04d_%s", m.Version, m.Name)
+		}
+	}
+
+	stores := store.NewSQLStores(db)
+	if cfg.Auth.LoginAttemptStore == "sql" {
+		stores.LoginAttempts = store.NewSQLLoginAttemptStore(db)
+	}
 
-	http.ListenAndServe(":8080", router)
+	return stores, db, nil
 }
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "book_rent"
+
+// Reasons of failed rentals
+const (
+	ReasonInvalidRequest = "invalid_request"
+	ReasonForbidden      = "forbidden"
+	ReasonBookNotFound   = "book_not_found"
+	ReasonUserNotFound   = "user_not_found"
+	ReasonOutOfStock     = "out_of_stock"
+	ReasonError          = "error"
+)
+
+// Route label of requests that matched no route, so unknown paths don't create new series
+const unmatchedRoute = "unmatched"
+
+// Method label of requests with a made-up method, any client can send one
+const otherMethod = "other"
+
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// Registry holds every metric of the server, it doesn't use the global default registry
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	rentals = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rentals_total",
+		Help:      "Books rented.",
+	})
+
+	returns = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "returns_total",
+		Help:      "Books returned.",
+	})
+
+	rentalFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rental_failures_total",
+		Help:      "Rent requests that failed, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		rentals,
+		returns,
+		rentalFailures,
+	)
+
+	// Export every reason from the start, rate() needs the zero
+	for _, reason := range []string{ReasonInvalidRequest, ReasonForbidden, ReasonBookNotFound, ReasonUserNotFound, ReasonOutOfStock, ReasonError} {
+		rentalFailures.WithLabelValues(reason)
+	}
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	})
+}
+
+// ObserveRequest records a served request. An empty route means no route matched.
+func ObserveRequest(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = unmatchedRoute
+	}
+	if !standardMethods[method] {
+		method = otherMethod
+	}
+	statusStr := strconv.Itoa(status)
+
+	httpRequests.WithLabelValues(method, route, statusStr).Inc()
+	httpDuration.WithLabelValues(method, route, statusStr).Observe(duration.Seconds())
+}
+
+func Rented() {
+	rentals.Inc()
+}
+
+func Returned() {
+	returns.Inc()
+}
+
+func RentalFailed(reason string) {
+	rentalFailures.WithLabelValues(reason).Inc()
+}
+
+// RegisterDB exports the sql.DBStats of the connection pool
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterInventory exports the active loans and the books with zero stock,
+// read from the stores on every scrape
+func RegisterInventory(books store.BookStore, rents store.RentStore, timeout time.Duration) error {
+	return Registry.Register(&inventoryCollector{
+		books:   books,
+		rents:   rents,
+		timeout: timeout,
+		activeLoans: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "active_loans"),
+			"Rented books that are not returned yet.", nil, nil),
+		outOfStock: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "books_out_of_stock"),
+			"Books with no copy left.", nil, nil),
+	})
+}
+
+type inventoryCollector struct {
+	books       store.BookStore
+	rents       store.RentStore
+	timeout     time.Duration
+	activeLoans *prometheus.Desc
+	outOfStock  *prometheus.Desc
+}
+
+func (c *inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeLoans
+	ch <- c.outOfStock
+}
+
+// Collect leaves out a gauge whose query failed instead of failing the whole scrape
+func (c *inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if count, err := c.rents.CountOpenLoans(ctx); err != nil {
+		slog.Warn("collecting active loans failed", "err", err.Error())
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.activeLoans, prometheus.GaugeValue, float64(count))
+	}
+
+	if count, err := c.books.CountOutOfStock(ctx); err != nil {
+		slog.Warn("collecting out of stock books failed", "err", err.Error())
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.outOfStock, prometheus.GaugeValue, float64(count))
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// Larger request bodies are cut off, 0 disables the limit
+	MaxBodyBytes int64
+	// How long in-flight requests get to finish on shutdown
+	ShutdownTimeout time.Duration
+	// How long to keep serving after a shutdown signal, so load balancers
+	// notice the failing readiness probe before the listener closes
+	ShutdownDelay time.Duration
+	// Both set enables TLS
+	TLSCertFile string
+	TLSKeyFile  string
+	// How often the certificate files are checked for changes, 0 only reloads on ReloadCertificates
+	TLSReloadInterval time.Duration
+}
+
+// Server runs the HTTP server and shuts it down in order: first in-flight
+// requests are drained, then the registered closers run, e.g. background jobs
+// and the database.
+type Server struct {
+	config   Config
+	http     *http.Server
+	certs    *CertReloader
+	onDrain  []func()
+	closers  []closer
+	watching atomic.Bool
+}
+
+type closer struct {
+	name string
+	f    func(ctx context.Context) error
+}
+
+// New loads the TLS certificate, if any, so a bad one fails before anything is served.
+// The certificate reloader is set up here and never replaced, the SIGHUP handler may use it any time.
+func New(config Config, handler http.Handler) (*Server, error) {
+	if config.MaxBodyBytes > 0 {
+		handler = limitBody(handler, config.MaxBodyBytes)
+	}
+
+	s := &Server{
+		config: config,
+		http: &http.Server{
+			Addr:              config.Addr,
+			Handler:           handler,
+			ReadTimeout:       config.ReadTimeout,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+			MaxHeaderBytes:    config.MaxHeaderBytes,
+			ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		},
+	}
+
+	if config.TLSCertFile != "" {
+		certs, err := NewCertReloader(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+
+		// Serve uses a listener we wrap ourselves, so HTTP/2 has to be offered here
+		s.http.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			NextProtos:     []string{"h2", "http/1.1"},
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	return s, nil
+}
+
+func limitBody(next http.Handler, n int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// OnDrain registers f to run as soon as a shutdown starts, before requests are drained
+func (s *Server) OnDrain(f func()) {
+	s.onDrain = append(s.onDrain, f)
+}
+
+// OnShutdown registers f to run after the HTTP server stopped.
+// Closers run in registration order.
+func (s *Server) OnShutdown(name string, f func(ctx context.Context) error) {
+	s.closers = append(s.closers, closer{name: name, f: f})
+}
+
+// ReloadCertificates reads the TLS certificate files again, it does nothing without TLS
+func (s *Server) ReloadCertificates() error {
+	if s.certs == nil {
+		return nil
+	}
+
+	return s.certs.Reload()
+}
+
+// CertificateStatus fails while the certificate files can't be reloaded or the watcher stopped.
+// The last good certificate is still served.
+func (s *Server) CertificateStatus(ctx context.Context) error {
+	if s.certs == nil {
+		return nil
+	}
+	if s.config.TLSReloadInterval > 0 && !s.watching.Load() {
+		return errors.New("certificate watcher is not running")
+	}
+
+	return s.certs.Err()
+}
+
+// Run serves until ctx is done, then shuts down gracefully
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+
+	if s.certs != nil {
+		listener = tls.NewListener(listener, s.http.TLSConfig)
+
+		if s.config.TLSReloadInterval > 0 {
+			watchCtx, stopWatch := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			s.watching.Store(true)
+			go func() {
+				defer close(done)
+				defer s.watching.Store(false)
+				s.certs.Watch(watchCtx, s.config.TLSReloadInterval)
+			}()
+			s.closers = append([]closer{{name: "certificate watcher", f: func(ctx context.Context) error {
+				stopWatch()
+				<-done
+				return nil
+			}}}, s.closers...)
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("server started", "addr", listener.Addr().String(), "tls", s.certs != nil)
+		serveErr <- s.http.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		// Failed before a shutdown was asked for
+		s.close()
+		return err
+	case <-ctx.Done():
+	}
+
+	for _, f := range s.onDrain {
+		f()
+	}
+	if s.config.ShutdownDelay > 0 {
+		slog.Info("shutdown requested, waiting before draining", "delay", s.config.ShutdownDelay)
+		time.Sleep(s.config.ShutdownDelay)
+	}
+
+	slog.Info("shutting down, draining connections", "timeout", s.config.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	err = s.http.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("shutdown timed out, closing remaining connections")
+		err = s.http.Close()
+	}
+	if serr := <-serveErr; serr != nil && !errors.Is(serr, http.ErrServerClosed) {
+		err = errors.Join(err, serr)
+	}
+
+	return errors.Join(err, s.close())
+}
+
+// close runs the closers, each gets the shutdown timeout of its own
+func (s *Server) close() error {
+	var errs []error
+	for _, c := range s.closers {
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+		if err := c.f(ctx); err != nil {
+			slog.Error("shutdown failed", "name", c.name, "err", err.Error())
+			errs = append(errs, err)
+		}
+		cancel()
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/database"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/google/uuid"
+)
+
+type APIKeyStore interface {
+	Insert(ctx context.Context, name, prefix, keyHash string, scopes []string, createdBy string, expiresAt *time.Time) (types.APIKey, error)
+	GetAll(ctx context.Context) ([]types.APIKey, error)
+	GetById(ctx context.Context, id string) (types.APIKey, error)
+	GetByPrefix(ctx context.Context, prefix string) (types.APIKey, error)
+	Rotate(ctx context.Context, id, prefix, keyHash string) error
+	Revoke(ctx context.Context, id string) error
+	UpdateLastUsed(ctx context.Context, id string) error
+}
+
+type SQLAPIKeyStore struct {
+	db *database.DB
+}
+
+func NewSQLAPIKeyStore(db *database.DB) *SQLAPIKeyStore {
+	return &SQLAPIKeyStore{db: db}
+}
+
+const apiKeyColumns = "id, name, prefix, key_hash, scopes, created_by, created_at, expires_at, last_used_at, revoked_at"
+
+func scanAPIKey(scanner interface{ Scan(...any) error }) (types.APIKey, error) {
+	var k types.APIKey
+	var scopes string
+	err := scanner.Scan(&k.Id, &k.Name, &k.Prefix, &k.KeyHash, &scopes, &k.CreatedBy, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt)
+	if err != nil {
+		return types.APIKey{}, err
+	}
+
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+
+	return k, nil
+}
+
+func (s *SQLAPIKeyStore) Insert(ctx context.Context, name, prefix, keyHash string, scopes []string, createdBy string, expiresAt *time.Time) (types.APIKey, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	id := uuid.New().String()
+	query := "INSERT INTO api_keys (id, name, prefix, key_hash, scopes, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := s.db.ExecContext(ctx, query, id, name, prefix, keyHash, strings.Join(scopes, ","), createdBy, time.Now(), expiresAt)
+	if err != nil {
+		return types.APIKey{}, err
+	}
+
+	return s.GetById(ctx, id)
+}
+
+func (s *SQLAPIKeyStore) GetAll(ctx context.Context) ([]types.APIKey, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []types.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *SQLAPIKeyStore) GetById(ctx context.Context, id string) (types.APIKey, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return scanAPIKey(s.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+}
+
+func (s *SQLAPIKeyStore) GetByPrefix(ctx context.Context, prefix string) (types.APIKey, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return scanAPIKey(s.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = ?", prefix))
+}
+
+// Rotate replaces the secret and keeps name, scopes and expiry
+func (s *SQLAPIKeyStore) Rotate(ctx context.Context, id, prefix, keyHash string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE api_keys SET prefix = ?, key_hash = ?, last_used_at = NULL WHERE id = ?", prefix, keyHash, id)
+	return err
+}
+
+func (s *SQLAPIKeyStore) Revoke(ctx context.Context, id string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now(), id)
+	return err
+}
+
+func (s *SQLAPIKeyStore) UpdateLastUsed(ctx context.Context, id string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now(), id)
+	return err
+}
@@ -1,25 +1,39 @@
 package store
 
 import (
+	"context"
 	"database/sql"
-
 	"time"
 
+	"github.com/burakiscoding/go-book-rent/database"
 	"github.com/burakiscoding/go-book-rent/types"
 )
 
-type BookStore struct {
-	db *sql.DB
+type BookStore interface {
+	GetAll(ctx context.Context) ([]types.Book, error)
+	GetById(ctx context.Context, id int) (types.Book, error)
+	Insert(ctx context.Context, name string, quantity int) error
+	Update(ctx context.Context, id int, name string) error
+	Delete(ctx context.Context, id int) error
+	CountOutOfStock(ctx context.Context) (int, error)
+	AddStock(ctx context.Context, id, count int) error
+}
+
+type SQLBookStore struct {
+	db *database.DB
 }
 
-func NewBookStore(db *sql.DB) *BookStore {
-	return &BookStore{
+func NewSQLBookStore(db *database.DB) *SQLBookStore {
+	return &SQLBookStore{
 		db: db,
 	}
 }
 
-func (s *BookStore) GetAll() ([]types.Book, error) {
-	rows, err := s.db.Query("SELECT id, name, created_at, quantity FROM books")
+func (s *SQLBookStore) GetAll(ctx context.Context) ([]types.Book, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, created_at, quantity FROM books")
 	if err != nil {
 		return nil, err
 	}
@@ -41,39 +55,88 @@ func (s *BookStore) GetAll() ([]types.Book, error) {
 	return books, nil
 }
 
-func (s *BookStore) GetById(id int) (types.Book, error) {
+func (s *SQLBookStore) GetById(ctx context.Context, id int) (types.Book, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
 	var book types.Book
 	query := "SELECT id, name, created_at, quantity FROM books WHERE id = ?"
-	if err := s.db.QueryRow(query, id).Scan(&book.Id, &book.Name, &book.CreatedAt, &book.Quantity); err != nil {
+	if err := s.db.QueryRowContext(ctx, query, id).Scan(&book.Id, &book.Name, &book.CreatedAt, &book.Quantity); err != nil {
 		return types.Book{}, err
 	}
 
 	return book, nil
 }
 
-func (s *BookStore) Insert(name string) error {
-	query := "INSERT INTO books (name, created_at) VALUES (?, ?)"
-	if _, err := s.db.Exec(query, name, time.Now()); err != nil {
+func (s *SQLBookStore) Insert(ctx context.Context, name string, quantity int) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO books (name, created_at, quantity) VALUES (?, ?, ?)"
+	if _, err := s.db.ExecContext(ctx, query, name, time.Now(), quantity); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s *BookStore) Update(id int, name string) error {
-	query := "UPDATE books SET name = ? WHERE id = ?"
-	if _, err := s.db.Exec(query, name, id); err != nil {
+// Update renames a book, it returns sql.ErrNoRows when there is no such book
+func (s *SQLBookStore) Update(ctx context.Context, id int, name string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, "UPDATE books SET name = ? WHERE id = ?", name, id)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return requireRow(result)
+}
+
+// Delete removes a book, it returns sql.ErrNoRows when there is no such book
+func (s *SQLBookStore) Delete(ctx context.Context, id int) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM books WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return requireRow(result)
+}
+
+func (s *SQLBookStore) CountOutOfStock(ctx context.Context) (int, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM books WHERE quantity <= 0").Scan(&count)
+	return count, err
+}
+
+// AddStock adds copies of a book, it returns sql.ErrNoRows when there is no such book
+func (s *SQLBookStore) AddStock(ctx context.Context, id, count int) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, "UPDATE books SET quantity = quantity + ? WHERE id = ?", count, id)
+	if err != nil {
+		return err
+	}
+
+	return requireRow(result)
 }
 
-func (s *BookStore) Delete(id int) error {
-	query := "DELETE FROM books	WHERE id = ?"
-	if _, err := s.db.Exec(query, id); err != nil {
+// requireRow returns sql.ErrNoRows when a statement matched no rows
+func requireRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
 		return err
 	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
 
 	return nil
 }
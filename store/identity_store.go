@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/database"
+)
+
+// IdentityStore links accounts of external identity providers to users
+type IdentityStore interface {
+	GetUserId(ctx context.Context, issuer, subject string) (string, error)
+	Link(ctx context.Context, issuer, subject, userId string) error
+}
+
+type SQLIdentityStore struct {
+	db *database.DB
+}
+
+func NewSQLIdentityStore(db *database.DB) *SQLIdentityStore {
+	return &SQLIdentityStore{db: db}
+}
+
+func (s *SQLIdentityStore) GetUserId(ctx context.Context, issuer, subject string) (string, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var userId string
+	query := "SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?"
+	err := s.db.QueryRowContext(ctx, query, issuer, subject).Scan(&userId)
+	return userId, err
+}
+
+func (s *SQLIdentityStore) Link(ctx context.Context, issuer, subject, userId string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO user_identities (issuer, subject, user_id, created_at) VALUES (?, ?, ?, ?)"
+	_, err := s.db.ExecContext(ctx, query, issuer, subject, userId, time.Now())
+	return err
+}
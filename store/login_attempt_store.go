@@ -0,0 +1,250 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/database"
+)
+
+// LoginAttemptStore keeps login attempts and account lockouts.
+// Keys are opaque, e.g. "user:alice" or "ip:10.0.0.1".
+type LoginAttemptStore interface {
+	// Attempt records an attempt unless the key has to wait. The wait is delay(attempts) after the
+	// last attempt, counting the attempts since the given time. The check and the insert are atomic
+	// per key, so parallel attempts can't all pass. It returns the attempts including this one.
+	Attempt(ctx context.Context, key string, at, since time.Time, delay func(attempts int) time.Duration) (int, time.Duration, error)
+	// RemoveAttempt forgets one attempt recorded at the given time
+	RemoveAttempt(ctx context.Context, key string, at time.Time) error
+	ClearAttempts(ctx context.Context, key string) error
+	Lock(ctx context.Context, username string, until time.Time) error
+	// GetLockedUntil returns the zero time if the account is not locked
+	GetLockedUntil(ctx context.Context, username string) (time.Time, error)
+	Unlock(ctx context.Context, username string) error
+	// Prune deletes attempts and lockouts that ended before the given time
+	Prune(ctx context.Context, before time.Time) error
+}
+
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+	lockouts map[string]time.Time
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{
+		attempts: make(map[string][]time.Time),
+		lockouts: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryLoginAttemptStore) Attempt(ctx context.Context, key string, at, since time.Time, delay func(attempts int) time.Duration) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop attempts that left the window so the map doesn't grow forever
+	var recent []time.Time
+	for _, attempt := range s.attempts[key] {
+		if attempt.After(since) {
+			recent = append(recent, attempt)
+		}
+	}
+
+	if len(recent) > 0 {
+		if wait := recent[len(recent)-1].Add(delay(len(recent))).Sub(at); wait > 0 {
+			s.attempts[key] = recent
+			return len(recent), wait, nil
+		}
+	}
+
+	s.attempts[key] = append(recent, at)
+	return len(recent) + 1, 0, nil
+}
+
+func (s *MemoryLoginAttemptStore) RemoveAttempt(ctx context.Context, key string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := s.attempts[key]
+	for i := len(attempts) - 1; i >= 0; i-- {
+		if attempts[i].Equal(at) {
+			attempts = append(attempts[:i], attempts[i+1:]...)
+			break
+		}
+	}
+
+	if len(attempts) == 0 {
+		delete(s.attempts, key)
+	} else {
+		s.attempts[key] = attempts
+	}
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) ClearAttempts(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(ctx context.Context, username string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lockouts[username] = until
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) GetLockedUntil(ctx context.Context, username string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lockouts[username], nil
+}
+
+func (s *MemoryLoginAttemptStore) Unlock(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.lockouts, username)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, attempts := range s.attempts {
+		// Attempts are appended in order, the last one is the newest
+		if !attempts[len(attempts)-1].After(before) {
+			delete(s.attempts, key)
+		}
+	}
+	for username, until := range s.lockouts {
+		if !until.After(before) {
+			delete(s.lockouts, username)
+		}
+	}
+	return nil
+}
+
+type SQLLoginAttemptStore struct {
+	db *database.DB
+}
+
+func NewSQLLoginAttemptStore(db *database.DB) *SQLLoginAttemptStore {
+	return &SQLLoginAttemptStore{db: db}
+}
+
+func (s *SQLLoginAttemptStore) Attempt(ctx context.Context, key string, at, since time.Time, delay func(attempts int) time.Duration) (int, time.Duration, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	// DATETIME keeps whole seconds on MySQL, RemoveAttempt has to find the same value
+	at = at.Truncate(time.Second)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// The upsert locks the row of the key until the commit, so attempts of one key run one by one
+	query := s.db.Dialect.Upsert("login_attempt_keys", []string{"attempt_key", "touched_at"}, []string{"attempt_key"}, []string{"touched_at"})
+	if _, err := tx.ExecContext(ctx, query, key, at); err != nil {
+		return 0, 0, err
+	}
+
+	var count int
+	query = "SELECT COUNT(*) FROM login_attempts WHERE attempt_key = ? AND attempted_at > ?"
+	if err := tx.QueryRowContext(ctx, query, key, since).Scan(&count); err != nil {
+		return 0, 0, err
+	}
+
+	if count > 0 {
+		// Not MAX(attempted_at), aggregates lose the column type on SQLite
+		var last time.Time
+		query = "SELECT attempted_at FROM login_attempts WHERE attempt_key = ? ORDER BY attempted_at DESC LIMIT 1"
+		if err := tx.QueryRowContext(ctx, query, key).Scan(&last); err != nil {
+			return 0, 0, err
+		}
+
+		if wait := last.Add(delay(count)).Sub(at); wait > 0 {
+			return count, wait, nil
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO login_attempts (attempt_key, attempted_at) VALUES (?, ?)", key, at); err != nil {
+		return 0, 0, err
+	}
+
+	return count + 1, 0, tx.Commit()
+}
+
+func (s *SQLLoginAttemptStore) RemoveAttempt(ctx context.Context, key string, at time.Time) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	// MySQL can't select from the table it deletes from, the derived table works around it
+	query := "DELETE FROM login_attempts WHERE id IN (SELECT id FROM (SELECT id FROM login_attempts WHERE attempt_key = ? AND attempted_at = ? LIMIT 1) AS attempt)"
+	_, err := s.db.ExecContext(ctx, query, key, at.Truncate(time.Second))
+	return err
+}
+
+func (s *SQLLoginAttemptStore) ClearAttempts(ctx context.Context, key string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE attempt_key = ?", key)
+	return err
+}
+
+func (s *SQLLoginAttemptStore) Lock(ctx context.Context, username string, until time.Time) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := s.db.Dialect.Upsert("account_lockouts", []string{"username", "locked_until"}, []string{"username"}, []string{"locked_until"})
+	_, err := s.db.ExecContext(ctx, query, username, until)
+	return err
+}
+
+func (s *SQLLoginAttemptStore) GetLockedUntil(ctx context.Context, username string) (time.Time, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var until time.Time
+	err := s.db.QueryRowContext(ctx, "SELECT locked_until FROM account_lockouts WHERE username = ?", username).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+
+	return until, err
+}
+
+func (s *SQLLoginAttemptStore) Unlock(ctx context.Context, username string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM account_lockouts WHERE username = ?", username)
+	return err
+}
+
+func (s *SQLLoginAttemptStore) Prune(ctx context.Context, before time.Time) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE attempted_at <= ?", before); err != nil {
+		return err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM login_attempt_keys WHERE touched_at <= ?", before); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM account_lockouts WHERE locked_until <= ?", before)
+	return err
+}
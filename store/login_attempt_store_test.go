@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func loginAttemptStores(t *testing.T) map[string]LoginAttemptStore {
+	return map[string]LoginAttemptStore{
+		"memory": NewMemoryLoginAttemptStore(),
+		"sqlite": NewSQLLoginAttemptStore(newSQLiteDB(t)),
+	}
+}
+
+// Three attempts are free, then everyone waits a minute
+func testDelay(attempts int) time.Duration {
+	if attempts < 3 {
+		return 0
+	}
+	return time.Minute
+}
+
+func TestLoginAttemptIsAtomic(t *testing.T) {
+	for name, s := range loginAttemptStores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			var passed atomic.Int32
+			var wg sync.WaitGroup
+			for range 30 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, wait, err := s.Attempt(context.Background(), "user:alice", now, now.Add(-time.Hour), testDelay)
+					if err != nil {
+						t.Error(err)
+					}
+					if wait == 0 {
+						passed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if passed.Load() != 3 {
+				t.Fatalf("%d parallel attempts passed, expected 3", passed.Load())
+			}
+		})
+	}
+}
+
+func TestRemoveAttempt(t *testing.T) {
+	for name, s := range loginAttemptStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+			since := now.Add(-time.Hour)
+
+			for i := range 2 {
+				if _, _, err := s.Attempt(ctx, "ip:192.0.2.1", now.Add(time.Duration(i)*time.Second), since, testDelay); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.RemoveAttempt(ctx, "ip:192.0.2.1", now.Add(time.Second)); err != nil {
+				t.Fatal(err)
+			}
+
+			attempts, wait, err := s.Attempt(ctx, "ip:192.0.2.1", now.Add(time.Second*2), since, testDelay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attempts != 2 || wait != 0 {
+				t.Fatalf("got %d attempts and wait %s, expected 2 and none", attempts, wait)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+// memoryDB holds the data of every in-memory store. All stores share one lock,
+// so operations that touch several tables are atomic like a SQL transaction.
+type memoryDB struct {
+	mu sync.Mutex
+
+	books      map[int]types.Book
+	nextBookId int
+	users      map[string]types.User
+	history    map[string]types.RentHistory
+
+	rolePermissions map[string][]string
+	mfa             map[string]types.UserMFA
+	recoveryCodes   map[string]map[string]*time.Time
+	sessions        map[string]types.Session
+	apiKeys         map[string]types.APIKey
+	identities      map[[2]string]string
+}
+
+// NewMemoryStores returns a complete in-memory implementation of the stores with the
+// default roles and permissions. Data is lost when the process exits.
+func NewMemoryStores() Stores {
+	db := &memoryDB{
+		books:      make(map[int]types.Book),
+		nextBookId: 1,
+		users:      make(map[string]types.User),
+		history:    make(map[string]types.RentHistory),
+		rolePermissions: map[string][]string{
+			types.RoleUser:      {},
+			types.RoleLibrarian: {types.PermBooksWrite, types.PermLoansManage, types.PermLoansCheckoutForOthers},
+			types.RoleAdmin:     append([]string{}, types.AllPermissions...),
+		},
+		mfa:           make(map[string]types.UserMFA),
+		recoveryCodes: make(map[string]map[string]*time.Time),
+		sessions:      make(map[string]types.Session),
+		apiKeys:       make(map[string]types.APIKey),
+		identities:    make(map[[2]string]string),
+	}
+
+	return Stores{
+		Books:         &MemoryBookStore{db: db},
+		Users:         &MemoryUserStore{db: db},
+		Rent:          &MemoryRentStore{db: db},
+		Roles:         &MemoryRoleStore{db: db},
+		MFA:           &MemoryMFAStore{db: db},
+		Sessions:      &MemorySessionStore{db: db},
+		APIKeys:       &MemoryAPIKeyStore{db: db},
+		Identities:    &MemoryIdentityStore{db: db},
+		LoginAttempts: NewMemoryLoginAttemptStore(),
+	}
+}
+
+var (
+	_ BookStore         = (*MemoryBookStore)(nil)
+	_ UserStore         = (*MemoryUserStore)(nil)
+	_ RentStore         = (*MemoryRentStore)(nil)
+	_ RoleStore         = (*MemoryRoleStore)(nil)
+	_ MFAStore          = (*MemoryMFAStore)(nil)
+	_ SessionStore      = (*MemorySessionStore)(nil)
+	_ APIKeyStore       = (*MemoryAPIKeyStore)(nil)
+	_ IdentityStore     = (*MemoryIdentityStore)(nil)
+	_ LoginAttemptStore = (*MemoryLoginAttemptStore)(nil)
+)
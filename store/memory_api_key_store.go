@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/google/uuid"
+)
+
+type MemoryAPIKeyStore struct {
+	db *memoryDB
+}
+
+func (s *MemoryAPIKeyStore) Insert(ctx context.Context, name, prefix, keyHash string, scopes []string, createdBy string, expiresAt *time.Time) (types.APIKey, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	k := types.APIKey{
+		Id:        uuid.New().String(),
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   keyHash,
+		Scopes:    slices.Clone(scopes),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	s.db.apiKeys[k.Id] = k
+
+	return k, nil
+}
+
+func (s *MemoryAPIKeyStore) GetAll(ctx context.Context) ([]types.APIKey, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var keys []types.APIKey
+	for _, k := range s.db.apiKeys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+
+	return keys, nil
+}
+
+func (s *MemoryAPIKeyStore) GetById(ctx context.Context, id string) (types.APIKey, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	k, ok := s.db.apiKeys[id]
+	if !ok {
+		return types.APIKey{}, sql.ErrNoRows
+	}
+
+	return k, nil
+}
+
+func (s *MemoryAPIKeyStore) GetByPrefix(ctx context.Context, prefix string) (types.APIKey, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, k := range s.db.apiKeys {
+		if k.Prefix == prefix {
+			return k, nil
+		}
+	}
+
+	return types.APIKey{}, sql.ErrNoRows
+}
+
+func (s *MemoryAPIKeyStore) Rotate(ctx context.Context, id, prefix, keyHash string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if k, ok := s.db.apiKeys[id]; ok {
+		k.Prefix = prefix
+		k.KeyHash = keyHash
+		k.LastUsedAt = nil
+		s.db.apiKeys[id] = k
+	}
+
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) Revoke(ctx context.Context, id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if k, ok := s.db.apiKeys[id]; ok && k.RevokedAt == nil {
+		now := time.Now()
+		k.RevokedAt = &now
+		s.db.apiKeys[id] = k
+	}
+
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) UpdateLastUsed(ctx context.Context, id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if k, ok := s.db.apiKeys[id]; ok {
+		now := time.Now()
+		k.LastUsedAt = &now
+		s.db.apiKeys[id] = k
+	}
+
+	return nil
+}
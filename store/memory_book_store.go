@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+type MemoryBookStore struct {
+	db *memoryDB
+}
+
+func (s *MemoryBookStore) GetAll(ctx context.Context) ([]types.Book, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var books []types.Book
+	for _, b := range s.db.books {
+		books = append(books, b)
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].Id < books[j].Id })
+
+	return books, nil
+}
+
+func (s *MemoryBookStore) GetById(ctx context.Context, id int) (types.Book, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	book, ok := s.db.books[id]
+	if !ok {
+		return types.Book{}, sql.ErrNoRows
+	}
+
+	return book, nil
+}
+
+func (s *MemoryBookStore) Insert(ctx context.Context, name string, quantity int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	id := s.db.nextBookId
+	s.db.nextBookId++
+	s.db.books[id] = types.Book{Id: id, Name: name, CreatedAt: time.Now(), Quantity: quantity}
+
+	return nil
+}
+
+func (s *MemoryBookStore) Update(ctx context.Context, id int, name string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	book, ok := s.db.books[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	book.Name = name
+	s.db.books[id] = book
+
+	return nil
+}
+
+func (s *MemoryBookStore) Delete(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.books[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.db.books, id)
+
+	return nil
+}
+
+func (s *MemoryBookStore) CountOutOfStock(ctx context.Context) (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	count := 0
+	for _, b := range s.db.books {
+		if b.Quantity <= 0 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *MemoryBookStore) AddStock(ctx context.Context, id, count int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	book, ok := s.db.books[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	book.Quantity += count
+	s.db.books[id] = book
+
+	return nil
+}
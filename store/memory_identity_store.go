@@ -0,0 +1,30 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type MemoryIdentityStore struct {
+	db *memoryDB
+}
+
+func (s *MemoryIdentityStore) GetUserId(ctx context.Context, issuer, subject string) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	userId, ok := s.db.identities[[2]string{issuer, subject}]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+
+	return userId, nil
+}
+
+func (s *MemoryIdentityStore) Link(ctx context.Context, issuer, subject, userId string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.identities[[2]string{issuer, subject}] = userId
+	return nil
+}
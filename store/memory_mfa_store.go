@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+type MemoryMFAStore struct {
+	db *memoryDB
+}
+
+func (s *MemoryMFAStore) GetByUserId(ctx context.Context, userId string) (types.UserMFA, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	mfa, ok := s.db.mfa[userId]
+	if !ok {
+		return types.UserMFA{}, sql.ErrNoRows
+	}
+
+	return mfa, nil
+}
+
+func (s *MemoryMFAStore) IsEnabled(ctx context.Context, userId string) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.db.mfa[userId].Enabled, nil
+}
+
+func (s *MemoryMFAStore) SetPendingSecret(ctx context.Context, userId, secret string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.mfa[userId].Enabled {
+		return nil
+	}
+	s.db.mfa[userId] = types.UserMFA{UserId: userId, Secret: secret}
+
+	return nil
+}
+
+func (s *MemoryMFAStore) UseStep(ctx context.Context, userId string, step int64) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	mfa, ok := s.db.mfa[userId]
+	if !ok || mfa.LastUsedStep >= step {
+		return false, nil
+	}
+	mfa.LastUsedStep = step
+	s.db.mfa[userId] = mfa
+
+	return true, nil
+}
+
+func (s *MemoryMFAStore) Enable(ctx context.Context, userId string, step int64, recoveryCodeHashes []string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	mfa, ok := s.db.mfa[userId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	mfa.Enabled = true
+	mfa.LastUsedStep = step
+	s.db.mfa[userId] = mfa
+
+	codes := make(map[string]*time.Time)
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = nil
+	}
+	s.db.recoveryCodes[userId] = codes
+
+	return nil
+}
+
+func (s *MemoryMFAStore) Disable(ctx context.Context, userId string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	delete(s.db.mfa, userId)
+	delete(s.db.recoveryCodes, userId)
+	return nil
+}
+
+func (s *MemoryMFAStore) UseRecoveryCode(ctx context.Context, userId, codeHash string) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	usedAt, ok := s.db.recoveryCodes[userId][codeHash]
+	if !ok || usedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	s.db.recoveryCodes[userId][codeHash] = &now
+	return true, nil
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/helpers"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/google/uuid"
+)
+
+type MemoryRentStore struct {
+	db *memoryDB
+}
+
+func (s *MemoryRentStore) GetAllHistory(ctx context.Context) ([]types.RentHistory, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var history []types.RentHistory
+	for _, h := range s.db.history {
+		history = append(history, h)
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].RentStartTime.Before(history[j].RentStartTime) })
+
+	return history, nil
+}
+
+func (s *MemoryRentStore) GetHistoryById(ctx context.Context, id string) (types.RentHistory, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	h, ok := s.db.history[id]
+	if !ok {
+		return types.RentHistory{}, sql.ErrNoRows
+	}
+
+	return h, nil
+}
+
+func (s *MemoryRentStore) GetUserHistory(ctx context.Context, userId string) ([]types.UserRentHistory, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var history []types.UserRentHistory
+	for _, h := range s.db.history {
+		book, ok := s.db.books[h.BookId]
+		if h.UserId != userId || !ok {
+			continue
+		}
+
+		history = append(history, types.UserRentHistory{
+			Id:                 h.Id,
+			RentStartTime:      h.RentStartTime,
+			RentReturnTime:     h.RentReturnTime,
+			RentDurationInDays: h.RentDurationInDays,
+			BookName:           book.Name,
+		})
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].RentStartTime.Before(history[j].RentStartTime) })
+
+	return history, nil
+}
+
+// RentBook inserts the history record and decreases the quantity under one lock
+func (s *MemoryRentStore) RentBook(ctx context.Context, bookId int, userId string, durationInDays int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	book, ok := s.db.books[bookId]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if book.Quantity <= 0 {
+		helpers.Logger(ctx).Info("book is out of stock", "book_id", bookId)
+		return ErrOutOfStock
+	}
+
+	if _, ok := s.db.users[userId]; !ok {
+		return sql.ErrNoRows
+	}
+
+	id := uuid.New().String()
+	s.db.history[id] = types.RentHistory{
+		Id:                 id,
+		BookId:             bookId,
+		UserId:             userId,
+		RentStartTime:      time.Now(),
+		RentDurationInDays: durationInDays,
+	}
+
+	book.Quantity--
+	s.db.books[bookId] = book
+
+	helpers.Logger(ctx).Debug("book rented", "rent_id", id, "book_id", bookId, "remaining", book.Quantity)
+	return nil
+}
+
+// ReturnBook sets the return time and increases the quantity under one lock
+func (s *MemoryRentStore) ReturnBook(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	h, ok := s.db.history[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if h.RentReturnTime != nil {
+		return ErrLoanAlreadyReturned
+	}
+
+	now := time.Now()
+	h.RentReturnTime = &now
+	s.db.history[id] = h
+
+	if book, ok := s.db.books[h.BookId]; ok {
+		book.Quantity++
+		s.db.books[h.BookId] = book
+	}
+
+	helpers.Logger(ctx).Debug("book returned", "rent_id", id, "book_id", h.BookId)
+	return nil
+}
+
+func (s *MemoryRentStore) CountOpenLoans(ctx context.Context) (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	count := 0
+	for _, h := range s.db.history {
+		if h.RentReturnTime == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
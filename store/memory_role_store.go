@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sort"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+type MemoryRoleStore struct {
+	db *memoryDB
+}
+
+func (s *MemoryRoleStore) GetUserRoleAndPermissions(ctx context.Context, userId string) (string, []string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	user, ok := s.db.users[userId]
+	if !ok || user.SuspendedAt != nil {
+		return "", nil, sql.ErrNoRows
+	}
+
+	return user.Role, slices.Clone(s.db.rolePermissions[user.Role]), nil
+}
+
+func (s *MemoryRoleStore) GetPermissions(ctx context.Context, role string) ([]string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return slices.Clone(s.db.rolePermissions[role]), nil
+}
+
+func (s *MemoryRoleStore) GetAll(ctx context.Context) ([]types.Role, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var roles []types.Role
+	for name, permissions := range s.db.rolePermissions {
+		roles = append(roles, types.Role{Name: name, Permissions: slices.Clone(permissions)})
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+
+	return roles, nil
+}
+
+func (s *MemoryRoleStore) Exists(ctx context.Context, name string) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	_, ok := s.db.rolePermissions[name]
+	return ok, nil
+}
+
+func (s *MemoryRoleStore) GrantPermission(ctx context.Context, role, permission string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	permissions, ok := s.db.rolePermissions[role]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	if !slices.Contains(permissions, permission) {
+		s.db.rolePermissions[role] = append(permissions, permission)
+	}
+
+	return nil
+}
+
+func (s *MemoryRoleStore) RevokePermission(ctx context.Context, role, permission string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if permissions, ok := s.db.rolePermissions[role]; ok {
+		s.db.rolePermissions[role] = slices.DeleteFunc(slices.Clone(permissions), func(p string) bool { return p == permission })
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/google/uuid"
+)
+
+type MemorySessionStore struct {
+	db *memoryDB
+}
+
+func (s *MemorySessionStore) NewId() string {
+	return uuid.New().String()
+}
+
+func (s *MemorySessionStore) Create(ctx context.Context, session types.Session) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.sessions[session.Id] = session
+	return nil
+}
+
+func (s *MemorySessionStore) GetById(ctx context.Context, id string) (types.Session, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	session, ok := s.db.sessions[id]
+	if !ok {
+		return types.Session{}, sql.ErrNoRows
+	}
+
+	return session, nil
+}
+
+func (s *MemorySessionStore) GetActiveByUserId(ctx context.Context, userId string) ([]types.Session, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	var sessions []types.Session
+	for _, session := range s.db.sessions {
+		if session.UserId == userId && session.RevokedAt == nil && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) GetAllByUserId(ctx context.Context, userId string) ([]types.Session, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var sessions []types.Session
+	for _, session := range s.db.sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) Touch(ctx context.Context, id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if session, ok := s.db.sessions[id]; ok {
+		session.LastSeenAt = time.Now()
+		s.db.sessions[id] = session
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) RotateRefreshToken(ctx context.Context, id, oldHash, newHash string) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	session, ok := s.db.sessions[id]
+	if !ok || session.RefreshTokenHash != oldHash || session.RevokedAt != nil {
+		return false, nil
+	}
+
+	session.RefreshTokenHash = newHash
+	session.LastSeenAt = time.Now()
+	s.db.sessions[id] = session
+
+	return true, nil
+}
+
+func (s *MemorySessionStore) Revoke(ctx context.Context, id string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if session, ok := s.db.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+		s.db.sessions[id] = session
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) RevokeAllByUserId(ctx context.Context, userId string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	for id, session := range s.db.sessions {
+		if session.UserId == userId && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			s.db.sessions[id] = session
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/google/uuid"
+)
+
+type MemoryUserStore struct {
+	db *memoryDB
+}
+
+func (s *MemoryUserStore) Insert(ctx context.Context, username, password, firstName, lastName, role string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// Like the UNIQUE constraint of the users table
+	for _, u := range s.db.users {
+		if u.Username == username {
+			return ErrUsernameTaken
+		}
+	}
+
+	id := uuid.New().String()
+	s.db.users[id] = types.User{
+		Id:        id,
+		Username:  username,
+		Password:  password,
+		FirstName: firstName,
+		LastName:  lastName,
+		Role:      role,
+		CreatedAt: time.Now(),
+	}
+
+	return nil
+}
+
+func (s *MemoryUserStore) GetByUsername(ctx context.Context, username string) (types.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, u := range s.db.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+
+	return types.User{}, sql.ErrNoRows
+}
+
+func (s *MemoryUserStore) GetById(ctx context.Context, id string) (types.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return types.User{}, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+func (s *MemoryUserStore) IsUsernameAvailable(ctx context.Context, username string) (bool, error) {
+	_, err := s.GetByUsername(ctx, username)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+
+	return false, err
+}
+
+func (s *MemoryUserStore) UpdateRole(ctx context.Context, id, role string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if user, ok := s.db.users[id]; ok {
+		user.Role = role
+		s.db.users[id] = user
+	}
+
+	return nil
+}
+
+func (s *MemoryUserStore) HasRole(ctx context.Context, role string) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, u := range s.db.users {
+		if u.Role == role {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *MemoryUserStore) Erase(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+
+	for _, h := range s.db.history {
+		if h.UserId == id && h.RentReturnTime == nil {
+			return ErrOpenLoans
+		}
+	}
+
+	if _, ok := s.db.users[types.TombstoneUserId]; !ok {
+		s.db.users[types.TombstoneUserId] = types.User{
+			Id:        types.TombstoneUserId,
+			Username:  types.TombstoneUsername,
+			Role:      types.RoleUser,
+			CreatedAt: time.Now(),
+		}
+	}
+
+	for historyId, h := range s.db.history {
+		if h.UserId == id {
+			h.UserId = types.TombstoneUserId
+			s.db.history[historyId] = h
+		}
+	}
+
+	for sessionId, session := range s.db.sessions {
+		if session.UserId == id {
+			delete(s.db.sessions, sessionId)
+		}
+	}
+
+	delete(s.db.mfa, id)
+	delete(s.db.recoveryCodes, id)
+
+	for key, userId := range s.db.identities {
+		if userId == id {
+			delete(s.db.identities, key)
+		}
+	}
+
+	now := time.Now()
+	for keyId, k := range s.db.apiKeys {
+		if k.CreatedBy == id && k.RevokedAt == nil {
+			k.RevokedAt = &now
+			s.db.apiKeys[keyId] = k
+		}
+	}
+
+	if user, ok := s.db.users[id]; ok {
+		s.db.users[id] = types.User{Id: id, Username: "erased-" + id, Role: types.RoleUser, CreatedAt: user.CreatedAt}
+	}
+
+	return nil
+}
+
+func (s *MemoryUserStore) UpdatePassword(ctx context.Context, id, password string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if user, ok := s.db.users[id]; ok {
+		user.Password = password
+		s.db.users[id] = user
+	}
+
+	return nil
+}
+
+func (s *MemoryUserStore) GetAll(ctx context.Context) ([]types.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var users []types.User
+	for _, u := range s.db.users {
+		if u.Id != types.TombstoneUserId {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+
+	return users, nil
+}
+
+func (s *MemoryUserStore) SetSuspended(ctx context.Context, id string, suspended bool) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return nil
+	}
+
+	if !suspended {
+		user.SuspendedAt = nil
+	} else if user.SuspendedAt == nil {
+		now := time.Now()
+		user.SuspendedAt = &now
+	}
+	s.db.users[id] = user
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/database"
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+type MFAStore interface {
+	GetByUserId(ctx context.Context, userId string) (types.UserMFA, error)
+	IsEnabled(ctx context.Context, userId string) (bool, error)
+	SetPendingSecret(ctx context.Context, userId, secret string) error
+	// UseStep records the TOTP step of a code. It returns false if this or a later step was already used.
+	UseStep(ctx context.Context, userId string, step int64) (bool, error)
+	Enable(ctx context.Context, userId string, step int64, recoveryCodeHashes []string) error
+	Disable(ctx context.Context, userId string) error
+	UseRecoveryCode(ctx context.Context, userId, codeHash string) (bool, error)
+}
+
+type SQLMFAStore struct {
+	db *database.DB
+}
+
+func NewSQLMFAStore(db *database.DB) *SQLMFAStore {
+	return &SQLMFAStore{db: db}
+}
+
+func (s *SQLMFAStore) GetByUserId(ctx context.Context, userId string) (types.UserMFA, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var mfa types.UserMFA
+	query := "SELECT user_id, secret, enabled, last_used_step FROM user_mfa WHERE user_id = ?"
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&mfa.UserId, &mfa.Secret, &mfa.Enabled, &mfa.LastUsedStep)
+	return mfa, err
+}
+
+func (s *SQLMFAStore) IsEnabled(ctx context.Context, userId string) (bool, error) {
+	mfa, err := s.GetByUserId(ctx, userId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return mfa.Enabled, nil
+}
+
+// SetPendingSecret starts a new enrollment. It is ignored while MFA is enabled.
+func (s *SQLMFAStore) SetPendingSecret(ctx context.Context, userId, secret string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// A pending enrollment is replaced, an enabled one is kept
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_mfa WHERE user_id = ? AND enabled = FALSE", userId)
+	if err != nil {
+		return err
+	}
+
+	query := s.db.Dialect.InsertIgnore("user_mfa", "user_id", "secret", "enabled", "last_used_step", "created_at")
+	_, err = tx.ExecContext(ctx, query, userId, secret, false, 0, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep only moves last_used_step forward, so two requests with the same code can't both pass
+func (s *SQLMFAStore) UseStep(ctx context.Context, userId string, step int64) (bool, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?"
+	result, err := s.db.ExecContext(ctx, query, step, userId, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// Enable confirms the enrollment and replaces the recovery codes
+func (s *SQLMFAStore) Enable(ctx context.Context, userId string, step int64, recoveryCodeHashes []string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE user_mfa SET enabled = TRUE, last_used_step = ? WHERE user_id = ?", step, userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = ?", userId)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)", userId, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLMFAStore) Disable(ctx context.Context, userId string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_mfa WHERE user_id = ?", userId); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = ?", userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks the code as used. It returns false if the code is unknown or already used.
+func (s *SQLMFAStore) UseRecoveryCode(ctx context.Context, userId, codeHash string) (bool, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE user_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL"
+	result, err := s.db.ExecContext(ctx, query, time.Now(), userId, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
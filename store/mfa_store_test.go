@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+func TestUseStepOnlyOnce(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := stores.Users.Insert(ctx, "alice", "", "Alice", "A", types.RoleUser); err != nil {
+				t.Fatal(err)
+			}
+			user, err := stores.Users.GetByUsername(ctx, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := stores.MFA.SetPendingSecret(ctx, user.Id, "secret"); err != nil {
+				t.Fatal(err)
+			}
+			if err := stores.MFA.Enable(ctx, user.Id, 100, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			// The same code sent twice at once
+			var passed atomic.Int32
+			var wg sync.WaitGroup
+			for range 20 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ok, err := stores.MFA.UseStep(ctx, user.Id, 101)
+					if err != nil {
+						t.Error(err)
+					}
+					if ok {
+						passed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if passed.Load() != 1 {
+				t.Fatalf("step was used %d times, expected once", passed.Load())
+			}
+
+			for _, step := range []int64{100, 101} {
+				if ok, err := stores.MFA.UseStep(ctx, user.Id, step); err != nil || ok {
+					t.Fatalf("old step %d was accepted: %v", step, err)
+				}
+			}
+		})
+	}
+}
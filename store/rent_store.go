@@ -2,26 +2,49 @@ package store
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"time"
 
+	"github.com/burakiscoding/go-book-rent/database"
+	"github.com/burakiscoding/go-book-rent/helpers"
 	"github.com/burakiscoding/go-book-rent/types"
 	"github.com/google/uuid"
 )
 
-type RentStore struct {
-	db *sql.DB
+// RentStore keeps the rent history. RentBook and ReturnBook change the history
+// and the book quantity together or not at all.
+type RentStore interface {
+	GetAllHistory(ctx context.Context) ([]types.RentHistory, error)
+	GetHistoryById(ctx context.Context, id string) (types.RentHistory, error)
+	GetUserHistory(ctx context.Context, userId string) ([]types.UserRentHistory, error)
+	RentBook(ctx context.Context, bookId int, userId string, durationInDays int) error
+	ReturnBook(ctx context.Context, id string) error
+	CountOpenLoans(ctx context.Context) (int, error)
 }
 
-func NewRentStore(db *sql.DB) *RentStore {
-	return &RentStore{db: db}
+// Errors of RentBook and ReturnBook. Like every store, missing rows are reported as sql.ErrNoRows.
+var (
+	ErrOutOfStock          = errors.New("book is out of stock")
+	ErrLoanAlreadyReturned = errors.New("loan is already returned")
+)
+
+type SQLRentStore struct {
+	db *database.DB
 }
 
-func (s *RentStore) GetAllHistory() ([]types.RentHistory, error) {
-	rows, err := s.db.Query("SELECT id, book_id, user_id, rent_duration_in_days, rent_start_time, rent_return_time FROM book_rent_history")
+func NewSQLRentStore(db *database.DB) *SQLRentStore {
+	return &SQLRentStore{db: db}
+}
+
+func (s *SQLRentStore) GetAllHistory(ctx context.Context) ([]types.RentHistory, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, book_id, user_id, rent_duration_in_days, rent_start_time, rent_return_time FROM book_rent_history")
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var history []types.RentHistory
 	for rows.Next() {
@@ -38,23 +61,30 @@ func (s *RentStore) GetAllHistory() ([]types.RentHistory, error) {
 	return history, nil
 }
 
-func (s *RentStore) GetHistoryById(id string) (types.RentHistory, error) {
+func (s *SQLRentStore) GetHistoryById(ctx context.Context, id string) (types.RentHistory, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
 	var h types.RentHistory
 	query := "SELECT id, book_id, user_id, rent_start_time, rent_return_time, rent_duration_in_days FROM book_rent_history WHERE id = ?"
-	err := s.db.QueryRow(query, id).Scan(&h.Id, &h.BookId, &h.UserId, &h.RentStartTime, &h.RentReturnTime, &h.RentDurationInDays)
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&h.Id, &h.BookId, &h.UserId, &h.RentStartTime, &h.RentReturnTime, &h.RentDurationInDays)
 	if err != nil {
-		return types.RentHistory{}, nil
+		return types.RentHistory{}, err
 	}
 
 	return h, nil
 }
 
-func (s *RentStore) GetUserHistory(userId string) ([]types.UserRentHistory, error) {
+func (s *SQLRentStore) GetUserHistory(ctx context.Context, userId string) ([]types.UserRentHistory, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
 	query := "SELECT R.id, R.rent_start_time, R.rent_return_time, R.rent_duration_in_days, B.name FROM book_rent_history AS R INNER JOIN books AS B on R.book_id = B.id WHERE R.user_id = ?"
-	rows, err := s.db.Query(query, userId)
+	rows, err := s.db.QueryContext(ctx, query, userId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var history []types.UserRentHistory
 	for rows.Next() {
@@ -71,16 +101,37 @@ func (s *RentStore) GetUserHistory(userId string) ([]types.UserRentHistory, erro
 	return history, nil
 }
 
-func (s *RentStore) RentBook(ctx context.Context, bookId int, userId string, durationInDays int) error {
+func (s *SQLRentStore) RentBook(ctx context.Context, bookId int, userId string, durationInDays int) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	// Lock the book row so two rents can't take the last copy
+	var quantity int
+	query := "SELECT quantity FROM books WHERE id = ?" + s.db.Dialect.ForUpdate()
+	if err := tx.QueryRowContext(ctx, query, bookId).Scan(&quantity); err != nil {
+		return err
+	}
+	if quantity <= 0 {
+		helpers.Logger(ctx).Info("book is out of stock", "book_id", bookId)
+		return ErrOutOfStock
+	}
+
+	// Lock the user row so the account can't be erased while the loan is created, see SQLUserStore.Erase
+	var lockedUserId string
+	query = "SELECT id FROM users WHERE id = ?" + s.db.Dialect.ForUpdate()
+	if err := tx.QueryRowContext(ctx, query, userId).Scan(&lockedUserId); err != nil {
+		return err
+	}
+
 	// Insert new record to the book_rent_history table
 	id := uuid.New()
-	query := "INSERT INTO book_rent_history (id, book_id, user_id, rent_duration_in_days, rent_start_time) VALUES (?, ?, ?, ?, ?)"
+	query = "INSERT INTO book_rent_history (id, book_id, user_id, rent_duration_in_days, rent_start_time) VALUES (?, ?, ?, ?, ?)"
 	_, err = tx.ExecContext(ctx, query, id, bookId, userId, durationInDays, time.Now())
 	if err != nil {
 		return err
@@ -97,23 +148,31 @@ func (s *RentStore) RentBook(ctx context.Context, bookId int, userId string, dur
 		return err
 	}
 
+	helpers.Logger(ctx).Debug("book rented", "rent_id", id.String(), "book_id", bookId, "remaining", quantity-1)
 	return nil
 }
 
-func (s *RentStore) ReturnBook(ctx context.Context, id string) error {
+func (s *SQLRentStore) ReturnBook(ctx context.Context, id string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Find the book
+	// Find the book, the lock keeps two returns from both increasing the quantity
 	var bookId int
-	query := "SELECT book_id FROM book_rent_history WHERE id = ?"
-	err = tx.QueryRowContext(ctx, query, id).Scan(&bookId)
+	var returnTime *time.Time
+	query := "SELECT book_id, rent_return_time FROM book_rent_history WHERE id = ?" + s.db.Dialect.ForUpdate()
+	err = tx.QueryRowContext(ctx, query, id).Scan(&bookId, &returnTime)
 	if err != nil {
 		return err
 	}
+	if returnTime != nil {
+		return ErrLoanAlreadyReturned
+	}
 
 	// Update rent_return_time in the rent_book_history table
 	query = "UPDATE book_rent_history SET rent_return_time = ? WHERE id = ?"
@@ -133,5 +192,15 @@ func (s *RentStore) ReturnBook(ctx context.Context, id string) error {
 		return err
 	}
 
+	helpers.Logger(ctx).Debug("book returned", "rent_id", id, "book_id", bookId)
 	return nil
 }
+
+func (s *SQLRentStore) CountOpenLoans(ctx context.Context) (int, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM book_rent_history WHERE rent_return_time IS NULL").Scan(&count)
+	return count, err
+}
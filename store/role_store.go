@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/burakiscoding/go-book-rent/database"
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+type RoleStore interface {
+	GetUserRoleAndPermissions(ctx context.Context, userId string) (string, []string, error)
+	GetPermissions(ctx context.Context, role string) ([]string, error)
+	GetAll(ctx context.Context) ([]types.Role, error)
+	Exists(ctx context.Context, name string) (bool, error)
+	GrantPermission(ctx context.Context, role, permission string) error
+	RevokePermission(ctx context.Context, role, permission string) error
+}
+
+type SQLRoleStore struct {
+	db *database.DB
+}
+
+func NewSQLRoleStore(db *database.DB) *SQLRoleStore {
+	return &SQLRoleStore{db: db}
+}
+
+// Role and permissions are read on every request so changes take effect without re-login.
+// Suspended users are not found, so their tokens and API keys stop working at once.
+func (s *SQLRoleStore) GetUserRoleAndPermissions(ctx context.Context, userId string) (string, []string, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var role string
+	if err := s.db.QueryRowContext(ctx, "SELECT role FROM users WHERE id = ? AND suspended_at IS NULL", userId).Scan(&role); err != nil {
+		return "", nil, err
+	}
+
+	permissions, err := s.GetPermissions(ctx, role)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return role, permissions, nil
+}
+
+func (s *SQLRoleStore) GetPermissions(ctx context.Context, role string) ([]string, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT permission FROM role_permissions WHERE role = ?", role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (s *SQLRoleStore) GetAll(ctx context.Context) ([]types.Role, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, "SELECT name FROM roles")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []types.Role
+	for rows.Next() {
+		var r types.Role
+		if err := rows.Scan(&r.Name); err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range roles {
+		permissions, err := s.GetPermissions(ctx, roles[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		roles[i].Permissions = permissions
+	}
+
+	return roles, nil
+}
+
+func (s *SQLRoleStore) Exists(ctx context.Context, name string) (bool, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var found string
+	err := s.db.QueryRowContext(ctx, "SELECT name FROM roles WHERE name = ?", name).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *SQLRoleStore) GrantPermission(ctx context.Context, role, permission string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := s.db.Dialect.InsertIgnore("role_permissions", "role", "permission")
+	_, err := s.db.ExecContext(ctx, query, role, permission)
+	return err
+}
+
+func (s *SQLRoleStore) RevokePermission(ctx context.Context, role, permission string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := "DELETE FROM role_permissions WHERE role = ? AND permission = ?"
+	_, err := s.db.ExecContext(ctx, query, role, permission)
+	return err
+}
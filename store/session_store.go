@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/burakiscoding/go-book-rent/database"
+	"github.com/burakiscoding/go-book-rent/types"
+	"github.com/google/uuid"
+)
+
+type SessionStore interface {
+	NewId() string
+	Create(ctx context.Context, session types.Session) error
+	GetById(ctx context.Context, id string) (types.Session, error)
+	GetActiveByUserId(ctx context.Context, userId string) ([]types.Session, error)
+	GetAllByUserId(ctx context.Context, userId string) ([]types.Session, error)
+	Touch(ctx context.Context, id string) error
+	RotateRefreshToken(ctx context.Context, id, oldHash, newHash string) (bool, error)
+	Revoke(ctx context.Context, id string) error
+	RevokeAllByUserId(ctx context.Context, userId string) error
+}
+
+type SQLSessionStore struct {
+	db *database.DB
+}
+
+func NewSQLSessionStore(db *database.DB) *SQLSessionStore {
+	return &SQLSessionStore{db: db}
+}
+
+const sessionColumns = "id, user_id, user_agent, ip, refresh_token_hash, created_at, last_seen_at, expires_at, revoked_at"
+
+func scanSession(scanner interface{ Scan(...any) error }) (types.Session, error) {
+	var s types.Session
+	err := scanner.Scan(&s.Id, &s.UserId, &s.UserAgent, &s.IP, &s.RefreshTokenHash, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.RevokedAt)
+	return s, err
+}
+
+// NewId returns the id of a session before it is created, so the refresh token can include it
+func (s *SQLSessionStore) NewId() string {
+	return uuid.New().String()
+}
+
+func (s *SQLSessionStore) Create(ctx context.Context, session types.Session) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := "INSERT INTO sessions (" + sessionColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULL)"
+	_, err := s.db.ExecContext(ctx, query, session.Id, session.UserId, session.UserAgent, session.IP, session.RefreshTokenHash,
+		session.CreatedAt, session.LastSeenAt, session.ExpiresAt)
+	return err
+}
+
+func (s *SQLSessionStore) GetById(ctx context.Context, id string) (types.Session, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	return scanSession(s.db.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id))
+}
+
+// GetActiveByUserId returns sessions that are neither revoked nor expired
+func (s *SQLSessionStore) GetActiveByUserId(ctx context.Context, userId string) ([]types.Session, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? ORDER BY last_seen_at DESC"
+	rows, err := s.db.QueryContext(ctx, query, userId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []types.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// GetAllByUserId returns every session of the user, revoked and expired ones too
+func (s *SQLSessionStore) GetAllByUserId(ctx context.Context, userId string) ([]types.Session, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + sessionColumns + " FROM sessions WHERE user_id = ? ORDER BY created_at DESC"
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []types.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (s *SQLSessionStore) Touch(ctx context.Context, id string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE sessions SET last_seen_at = ? WHERE id = ?", time.Now(), id)
+	return err
+}
+
+// RotateRefreshToken only succeeds if the old hash still matches, so a refresh token can be used once
+func (s *SQLSessionStore) RotateRefreshToken(ctx context.Context, id, oldHash, newHash string) (bool, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE sessions SET refresh_token_hash = ?, last_seen_at = ? WHERE id = ? AND refresh_token_hash = ? AND revoked_at IS NULL"
+	result, err := s.db.ExecContext(ctx, query, newHash, time.Now(), id, oldHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (s *SQLSessionStore) Revoke(ctx context.Context, id string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now(), id)
+	return err
+}
+
+func (s *SQLSessionStore) RevokeAllByUserId(ctx context.Context, userId string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now(), userId)
+	return err
+}
@@ -0,0 +1,33 @@
+package store
+
+import "github.com/burakiscoding/go-book-rent/database"
+
+// Stores bundles one implementation of every store
+type Stores struct {
+	Books         BookStore
+	Users         UserStore
+	Rent          RentStore
+	Roles         RoleStore
+	MFA           MFAStore
+	Sessions      SessionStore
+	APIKeys       APIKeyStore
+	Identities    IdentityStore
+	LoginAttempts LoginAttemptStore
+}
+
+// NewSQLStores returns the stores for a MySQL, PostgreSQL or SQLite database, db.Dialect
+// covers the differences. Login attempts are kept in memory,
+// use NewSQLLoginAttemptStore to share them between instances.
+func NewSQLStores(db *database.DB) Stores {
+	return Stores{
+		Books:         NewSQLBookStore(db),
+		Users:         NewSQLUserStore(db),
+		Rent:          NewSQLRentStore(db),
+		Roles:         NewSQLRoleStore(db),
+		MFA:           NewSQLMFAStore(db),
+		Sessions:      NewSQLSessionStore(db),
+		APIKeys:       NewSQLAPIKeyStore(db),
+		Identities:    NewSQLIdentityStore(db),
+		LoginAttempts: NewMemoryLoginAttemptStore(),
+	}
+}
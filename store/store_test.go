@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/burakiscoding/go-book-rent/database"
+)
+
+// newSQLiteDB returns a migrated database in a temporary file
+func newSQLiteDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	db, err := database.NewSQLWithConfig(database.Config{
+		Driver: database.DriverSQLite,
+		Name:   filepath.Join(t.TempDir(), "test.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// testStores returns both implementations, tests run against each of them
+func testStores(t *testing.T) map[string]Stores {
+	return map[string]Stores{
+		"memory": NewMemoryStores(),
+		"sqlite": NewSQLStores(newSQLiteDB(t)),
+	}
+}
@@ -1,47 +1,85 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"time"
 
+	"github.com/burakiscoding/go-book-rent/database"
 	"github.com/burakiscoding/go-book-rent/types"
 	"github.com/google/uuid"
 )
 
-type UserStore struct {
-	db *sql.DB
+type UserStore interface {
+	Insert(ctx context.Context, username, password, firstName, lastName, role string) error
+	GetByUsername(ctx context.Context, username string) (types.User, error)
+	GetById(ctx context.Context, id string) (types.User, error)
+	IsUsernameAvailable(ctx context.Context, username string) (bool, error)
+	UpdateRole(ctx context.Context, id, role string) error
+	HasRole(ctx context.Context, role string) (bool, error)
+	Erase(ctx context.Context, id string) error
+	UpdatePassword(ctx context.Context, id, password string) error
+	GetAll(ctx context.Context) ([]types.User, error)
+	SetSuspended(ctx context.Context, id string, suspended bool) error
 }
 
-func NewUserStore(db *sql.DB) *UserStore {
-	return &UserStore{db: db}
+// ErrOpenLoans is returned by Erase while the user still has books
+var ErrOpenLoans = errors.New("user has open loans")
+
+// ErrUsernameTaken is returned by Insert when another user has the username,
+// IsUsernameAvailable can't rule it out for parallel registrations
+var ErrUsernameTaken = errors.New("username is taken")
+
+type SQLUserStore struct {
+	db *database.DB
+}
+
+func NewSQLUserStore(db *database.DB) *SQLUserStore {
+	return &SQLUserStore{db: db}
 }
 
-func (s *UserStore) Insert(username, password, firstName, lastName, role string) error {
+func (s *SQLUserStore) Insert(ctx context.Context, username, password, firstName, lastName, role string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
 	id := uuid.New()
 
 	query := "INSERT INTO users (id, username, password, first_name, last_name, role, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
-	_, err := s.db.Exec(query, id, username, password, firstName, lastName, role, time.Now())
+	_, err := s.db.ExecContext(ctx, query, id, username, password, firstName, lastName, role, time.Now())
+	if database.IsUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
 
 	return err
 }
 
-func (s *UserStore) GetByUsername(username string) (types.User, error) {
+func (s *SQLUserStore) GetByUsername(ctx context.Context, username string) (types.User, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
 	var user types.User
-	query := "SELECT id, username, password, first_name, last_name, role, created_at FROM users WHERE username = ?"
-	err := s.db.QueryRow(query, username).Scan(&user.Id, &user.Username, &user.Password, &user.FirstName, &user.LastName, &user.Role, &user.CreatedAt)
+	query := "SELECT id, username, password, first_name, last_name, role, created_at, suspended_at FROM users WHERE username = ?"
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&user.Id, &user.Username, &user.Password, &user.FirstName, &user.LastName, &user.Role, &user.CreatedAt, &user.SuspendedAt)
 	return user, err
 }
 
-func (s *UserStore) GetById(id string) (types.User, error) {
+func (s *SQLUserStore) GetById(ctx context.Context, id string) (types.User, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
 	var user types.User
-	query := "SELECT id, username, password, first_name, last_name, role, created_at FROM users WHERE id = ?"
-	err := s.db.QueryRow(query, id).Scan(&user.Id, &user.Username, &user.Password, &user.FirstName, &user.LastName, &user.Role, &user.CreatedAt)
+	query := "SELECT id, username, password, first_name, last_name, role, created_at, suspended_at FROM users WHERE id = ?"
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&user.Id, &user.Username, &user.Password, &user.FirstName, &user.LastName, &user.Role, &user.CreatedAt, &user.SuspendedAt)
 	return user, err
 }
 
-func (s *UserStore) IsUsernameAvailable(username string) (bool, error) {
+func (s *SQLUserStore) IsUsernameAvailable(ctx context.Context, username string) (bool, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
 	var id string
-	err := s.db.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&id)
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE username = ?", username).Scan(&id)
 
 	// Username is available
 	if err == sql.ErrNoRows {
@@ -50,3 +88,140 @@ func (s *UserStore) IsUsernameAvailable(username string) (bool, error) {
 
 	return false, err
 }
+
+func (s *SQLUserStore) UpdateRole(ctx context.Context, id, role string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET role = ? WHERE id = ?", role, id)
+	return err
+}
+
+func (s *SQLUserStore) HasRole(ctx context.Context, role string) (bool, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var id string
+	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE role = ? LIMIT 1", role).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Erase removes personal data of a user. Rent history is kept for inventory integrity
+// and moved to the tombstone user, everything else linked to the user is deleted.
+// Users with open loans are refused with ErrOpenLoans, nobody would be left to return the books.
+func (s *SQLUserStore) Erase(ctx context.Context, id string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user row, RentBook locks it too so no loan can start between the check and the erasure
+	var userId string
+	query := "SELECT id FROM users WHERE id = ?" + s.db.Dialect.ForUpdate()
+	if err := tx.QueryRowContext(ctx, query, id).Scan(&userId); err != nil {
+		return err
+	}
+
+	var loanId string
+	query = "SELECT id FROM book_rent_history WHERE user_id = ? AND rent_return_time IS NULL LIMIT 1"
+	err = tx.QueryRowContext(ctx, query, id).Scan(&loanId)
+	if err == nil {
+		return ErrOpenLoans
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	// Create the tombstone identity on first use
+	query = s.db.Dialect.InsertIgnore("users", "id", "username", "password", "first_name", "last_name", "role", "created_at")
+	_, err = tx.ExecContext(ctx, query, types.TombstoneUserId, types.TombstoneUsername, "", "", "", types.RoleUser, time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE book_rent_history SET user_id = ? WHERE user_id = ?", types.TombstoneUserId, id)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"sessions", "user_mfa", "user_recovery_codes", "user_identities"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = ?", id); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE api_keys SET revoked_at = ? WHERE created_by = ? AND revoked_at IS NULL", time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	// The row stays so references keep working, but nothing in it identifies the person
+	query = "UPDATE users SET username = ?, password = '', first_name = '', last_name = '', role = ? WHERE id = ?"
+	_, err = tx.ExecContext(ctx, query, "erased-"+id, types.RoleUser, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLUserStore) UpdatePassword(ctx context.Context, id, password string) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET password = ? WHERE id = ?", password, id)
+	return err
+}
+
+// GetAll returns every user except the tombstone user of erased accounts
+func (s *SQLUserStore) GetAll(ctx context.Context) ([]types.User, error) {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT id, username, password, first_name, last_name, role, created_at, suspended_at FROM users WHERE id <> ? ORDER BY created_at"
+	rows, err := s.db.QueryContext(ctx, query, types.TombstoneUserId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []types.User
+	for rows.Next() {
+		var u types.User
+		if err := rows.Scan(&u.Id, &u.Username, &u.Password, &u.FirstName, &u.LastName, &u.Role, &u.CreatedAt, &u.SuspendedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SetSuspended suspends or reinstates a user. Suspending again keeps the first time.
+func (s *SQLUserStore) SetSuspended(ctx context.Context, id string, suspended bool) error {
+	ctx, cancel := s.db.WithTimeout(ctx)
+	defer cancel()
+
+	var err error
+	if suspended {
+		_, err = s.db.ExecContext(ctx, "UPDATE users SET suspended_at = COALESCE(suspended_at, ?) WHERE id = ?", time.Now(), id)
+	} else {
+		_, err = s.db.ExecContext(ctx, "UPDATE users SET suspended_at = NULL WHERE id = ?", id)
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/burakiscoding/go-book-rent/types"
+)
+
+func TestInsertRejectsTakenUsername(t *testing.T) {
+	for name, stores := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			// Parallel registrations that all saw the username as available
+			var inserted, taken atomic.Int32
+			var wg sync.WaitGroup
+			for range 20 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := stores.Users.Insert(ctx, "alice", "", "Alice", "A", types.RoleUser)
+					switch err {
+					case nil:
+						inserted.Add(1)
+					case ErrUsernameTaken:
+						taken.Add(1)
+					default:
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if inserted.Load() != 1 || taken.Load() != 19 {
+				t.Fatalf("%d inserted and %d taken, expected 1 and 19", inserted.Load(), taken.Load())
+			}
+		})
+	}
+}
@@ -7,20 +7,52 @@ type ContextKey string
 const (
 	RoleUser          string     = "user"
 	RoleAdmin         string     = "admin"
+	RoleLibrarian     string     = "librarian"
 	KeyId             ContextKey = "KeyId"
 	KeyRole           ContextKey = "KeyRole"
+	KeyPermissions    ContextKey = "KeyPermissions"
+	KeySessionId      ContextKey = "KeySessionId"
+	KeyLogger         ContextKey = "KeyLogger"
+	KeyRequestId      ContextKey = "KeyRequestId"
+	KeyAccessLog      ContextKey = "KeyAccessLog"
 	MinRentTimeInDays int        = 1
 	MaxRentTimeInDays int        = 30
 )
 
+// Rent history of erased users points to this user
+const (
+	TombstoneUserId   string = "00000000-0000-0000-0000-000000000000"
+	TombstoneUsername string = "erased-user"
+)
+
+// Permissions are granted to roles in the role_permissions table
+const (
+	PermBooksWrite             string = "books:write"
+	PermLoansManage            string = "loans:manage"
+	PermLoansCheckoutForOthers string = "loans:checkout_for_others"
+	PermUsersManage            string = "users:manage"
+	PermAPIKeysManage          string = "api_keys:manage"
+	PermMetricsRead            string = "metrics:read"
+)
+
+var AllPermissions = []string{
+	PermBooksWrite,
+	PermLoansManage,
+	PermLoansCheckoutForOthers,
+	PermUsersManage,
+	PermAPIKeysManage,
+	PermMetricsRead,
+}
+
 type User struct {
-	Id        string    `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"password"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
+	Id          string     `json:"id"`
+	Username    string     `json:"username"`
+	Password    string     `json:"-"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	Role        string     `json:"role"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SuspendedAt *time.Time `json:"suspended_at"`
 }
 
 type Book struct {
@@ -40,37 +72,45 @@ type RentHistory struct {
 }
 
 type AddBookRequest struct {
-	Name string `json:"name"`
+	Name     string `json:"name" validate:"required,max=255"`
+	Quantity int    `json:"quantity" validate:"min=0"`
+}
+
+type AddStockRequest struct {
+	Quantity int `json:"quantity" validate:"required,min=1"`
 }
 
 type UpdateBookRequest struct {
-	Name string `json:"name"`
+	Name string `json:"name" validate:"required,max=255"`
 }
 
 type RegisterUserRequest struct {
-	Username  string `json:"username"`
-	Password  string `json:"password"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	Username  string `json:"username" validate:"required,max=255,pattern=username"`
+	Password  string `json:"password" validate:"required"`
+	FirstName string `json:"first_name" validate:"required,max=100"`
+	LastName  string `json:"last_name" validate:"required,max=100"`
 }
 
 type LoginUserRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username string `json:"username" validate:"required,max=255"`
+	Password string `json:"password" validate:"required"`
 }
 
 type TokenPayload struct {
-	Id   string
-	Role string
+	Id          string
+	Role        string
+	SessionId   string
+	Permissions []string
 }
 
 type RentBookRequest struct {
-	BookId         int `json:"book_id"`
-	DurationInDays int `json:"duration_in_days"`
+	BookId         int    `json:"book_id" validate:"required,min=1"`
+	DurationInDays int    `json:"duration_in_days" validate:"required,min=1,max=30"` // MinRentTimeInDays, MaxRentTimeInDays
+	UserId         string `json:"user_id,omitempty" validate:"uuid"`
 }
 
 type ReturnBookRequest struct {
-	Id string `json:"id"`
+	Id string `json:"id" validate:"required,uuid"`
 }
 
 type UserRentHistory struct {
@@ -80,3 +120,113 @@ type UserRentHistory struct {
 	RentDurationInDays int        `json:"rent_duration_in_days"`
 	BookName           string     `json:"book_name"`
 }
+
+type Role struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" validate:"required,max=32"`
+}
+
+type PermissionRequest struct {
+	Permission string `json:"permission" validate:"required,permission"`
+}
+
+type UserMFA struct {
+	UserId       string
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+type MFAEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
+
+type MFAEnrollmentRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	MFAToken           string `json:"mfa_token"`
+}
+
+type LoginResponse struct {
+	Token         string   `json:"token"`
+	RefreshToken  string   `json:"refresh_token,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type APIKey struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,permission"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0,max=3650"`
+}
+
+// The plain key is only returned once, on create and rotate
+type APIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type Session struct {
+	Id               string     `json:"id"`
+	UserId           string     `json:"user_id"`
+	UserAgent        string     `json:"user_agent"`
+	IP               string     `json:"ip"`
+	RefreshTokenHash string     `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+	LastSeenAt       time.Time  `json:"last_seen_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	Current          bool       `json:"current"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type DataExport struct {
+	ExportedAt  time.Time         `json:"exported_at"`
+	Profile     User              `json:"profile"`
+	MFAEnabled  bool              `json:"mfa_enabled"`
+	RentHistory []UserRentHistory `json:"rent_history"`
+	Sessions    []Session         `json:"sessions"`
+}
+
+// EraseAccountRequest confirms the erasure of the own account. The password can be left out
+// right after a login, accounts without a password always log in again instead.
+type EraseAccountRequest struct {
+	Password string `json:"password"`
+}